@@ -8,5 +8,10 @@ import (
 func accountNotifier() {
 	notifier := accountnotifier.NewAccountNotifier()
 	runner := reconcile.NewIntegrationRunner(notifier, accountnotifier.IntegrationName)
+	if runner.NeedsBundle() {
+		runner.Bundle = newBundleShaGetter()
+	}
+	runner.NewLeaseStore = newLeaseStore
+	runner.NewHistoryStore = newHistoryStore
 	runner.Run()
 }
@@ -8,5 +8,10 @@ import (
 func gitPartitionSyncProducer() {
 	p := producer.NewGitPartitionSyncProducer()
 	runner := reconcile.NewIntegrationRunner(p, "git-partition-sync-producer")
+	if runner.NeedsBundle() {
+		runner.Bundle = newBundleShaGetter()
+	}
+	runner.NewLeaseStore = newLeaseStore
+	runner.NewHistoryStore = newHistoryStore
 	runner.Run()
 }
@@ -2,10 +2,12 @@
 package cmd
 
 import (
+	"context"
 	"time"
 
 	defaultlog "log"
 
+	"github.com/app-sre/go-qontract-reconcile/pkg/tracing"
 	"github.com/app-sre/go-qontract-reconcile/pkg/util"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -14,8 +16,10 @@ import (
 )
 
 var (
-	cfgFile  string
-	logLevel string
+	cfgFile    string
+	logLevel   string
+	statusJSON bool
+	prefix     string
 
 	rootCmd = &cobra.Command{
 		Use:   "qo-contract-reconcile",
@@ -50,6 +54,47 @@ var (
 		},
 	}
 
+	runCmd = &cobra.Command{
+		Use:   "run integration...",
+		Short: "Run multiple integrations in one process",
+		Long:  "Run multiple integrations in one process, sharing one metrics and health server",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if err := cobra.MinimumNArgs(1)(cmd, args); err != nil {
+				return err
+			}
+			return validateIntegrationNames(args)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			run(args)
+		},
+	}
+
+	statusCmd = &cobra.Command{
+		Use:   "status integration",
+		Short: "Show the run history of an integration",
+		Long:  "Print the last runs of an integration from the run history in the app-interface state bucket",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			status(args[0], statusJSON)
+		},
+	}
+
+	stateCmd = &cobra.Command{
+		Use:   "state",
+		Short: "Manage the state of integrations",
+		Long:  "Manage the state integrations keep in the app-interface state bucket",
+	}
+
+	stateReencryptCmd = &cobra.Command{
+		Use:   "reencrypt integration",
+		Short: "Reencrypt the state of an integration",
+		Long:  "Encrypt all state values of an integration with the current identity of state_encryption, i.e. before removing old identities",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			reencryptState(args[0], prefix)
+		},
+	}
+
 	validateKeyCmd = &cobra.Command{
 		Use:   "validate-key",
 		Short: "Validates a key in a given user file",
@@ -70,14 +115,26 @@ func init() {
 	rootCmd.AddCommand(accountNotifierCmd)
 	rootCmd.AddCommand(gitPartitionSyncProducerCmd)
 	rootCmd.AddCommand(validateKeyCmd)
+	rootCmd.AddCommand(runCmd)
+	rootCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(stateCmd)
+	stateCmd.AddCommand(stateReencryptCmd)
 	rootCmd.PersistentFlags().StringVarP(&logLevel, "logLevel", "l", "info", "Log level")
+	rootCmd.PersistentFlags().Bool("allow-deletions", false, "Run Reconcile even if planned deletions exceed maxdeletions or maxdeletionspercent")
+	viper.BindPFlag("allowdeletions", rootCmd.PersistentFlags().Lookup("allow-deletions"))
 	userValidatorCmd.Flags().StringVarP(&cfgFile, "cfgFile", "c", "", "Configuration File")
 	accountNotifierCmd.Flags().StringVarP(&cfgFile, "cfgFile", "c", "", "Configuration File")
 	gitPartitionSyncProducerCmd.Flags().StringVarP(&cfgFile, "cfgFile", "c", "", "Configuration File")
 	validateKeyCmd.Flags().StringVarP(&cfgFile, "cfgFile", "c", "", "Configuration File")
+	runCmd.Flags().StringVarP(&cfgFile, "cfgFile", "c", "", "Configuration File")
+	statusCmd.Flags().StringVarP(&cfgFile, "cfgFile", "c", "", "Configuration File")
+	statusCmd.Flags().BoolVar(&statusJSON, "json", false, "Print the run history as JSON")
+	stateReencryptCmd.Flags().StringVarP(&cfgFile, "cfgFile", "c", "", "Configuration File")
+	stateReencryptCmd.Flags().StringVar(&prefix, "prefix", "", "Only reencrypt keys starting with prefix")
 
 	cobra.OnInitialize(initConfig)
 	cobra.OnInitialize(configureLogging)
+	cobra.OnInitialize(configureTracing)
 }
 
 func initConfig() {
@@ -89,10 +146,27 @@ func initConfig() {
 	}
 }
 
+func configureTracing() {
+	if err := tracing.Setup(context.Background()); err != nil {
+		util.Log().Fatalw("Error while configuring tracing", "error", err.Error())
+	}
+}
+
 func configureLogging() {
+	logger, err := newLoggerConfig(logLevel).Build()
+	zap.ReplaceGlobals(logger)
+
+	if err != nil {
+		defaultlog.Fatal(err)
+	}
+}
+
+// newLoggerConfig creates the zap configuration for level. Logs always go to stderr, stdout is kept
+// clean for planoutput "-".
+func newLoggerConfig(level string) zap.Config {
 	loggerConfig := zap.NewDevelopmentConfig()
 
-	switch logLevel {
+	switch level {
 	case "info":
 		loggerConfig.Level = zap.NewAtomicLevelAt(zap.InfoLevel)
 	case "debug":
@@ -110,11 +184,7 @@ func configureLogging() {
 	}
 
 	loggerConfig.EncoderConfig.EncodeTime = zapcore.TimeEncoderOfLayout(time.RFC3339)
-
-	logger, err := loggerConfig.Build()
-	zap.ReplaceGlobals(logger)
-
-	if err != nil {
-		defaultlog.Fatal(err)
-	}
+	loggerConfig.OutputPaths = []string{"stderr"}
+	loggerConfig.ErrorOutputPaths = []string{"stderr"}
+	return loggerConfig
 }
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/app-sre/go-qontract-reconcile/pkg/reconcile"
+	"github.com/stretchr/testify/assert"
+)
+
+// redirect points *f to a new file in dir until the test ends
+func redirect(t *testing.T, f **os.File, name string) string {
+	path := filepath.Join(t.TempDir(), name)
+	file, err := os.Create(path)
+	assert.NoError(t, err)
+	original := *f
+	*f = file
+	t.Cleanup(func() {
+		*f = original
+		file.Close()
+	})
+	return path
+}
+
+func TestPlanOutputStdoutWithoutLogs(t *testing.T) {
+	stdout := redirect(t, &os.Stdout, "stdout")
+	stderr := redirect(t, &os.Stderr, "stderr")
+
+	logger, err := newLoggerConfig("debug").Build()
+	assert.NoError(t, err)
+	logger.Sugar().Infow("Planned actions", "integration", "test")
+
+	plan := reconcile.NewPlan("test")
+	plan.Add("a", reconcile.ActionDelete, "", "")
+	assert.NoError(t, plan.WriteFile("-"))
+
+	out, err := os.ReadFile(stdout)
+	assert.NoError(t, err)
+	var written map[string]interface{}
+	assert.NoError(t, json.Unmarshal(out, &written))
+
+	logs, err := os.ReadFile(stderr)
+	assert.NoError(t, err)
+	assert.Contains(t, string(logs), "Planned actions")
+}
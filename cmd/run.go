@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/app-sre/go-qontract-reconcile/internal/accountnotifier"
+	"github.com/app-sre/go-qontract-reconcile/internal/gitpartitionsync/producer"
+	"github.com/app-sre/go-qontract-reconcile/pkg/aws"
+	"github.com/app-sre/go-qontract-reconcile/pkg/gql"
+	"github.com/app-sre/go-qontract-reconcile/pkg/reconcile"
+	"github.com/app-sre/go-qontract-reconcile/pkg/state"
+	"github.com/app-sre/go-qontract-reconcile/pkg/util"
+	"github.com/app-sre/go-qontract-reconcile/pkg/vault"
+	"github.com/pkg/errors"
+)
+
+// integrations are all Integrations, that can be started with the run command
+var integrations = map[string]func() reconcile.Integration{
+	accountnotifier.IntegrationName: func() reconcile.Integration {
+		return accountnotifier.NewAccountNotifier()
+	},
+	"git-partition-sync-producer": func() reconcile.Integration {
+		return producer.NewGitPartitionSyncProducer()
+	},
+}
+
+// newBundleShaGetter creates the qontract-server client used by the bundle trigger mode and the run history
+func newBundleShaGetter() reconcile.BundleShaGetter {
+	client, err := gql.NewQontractClient(context.Background())
+	if err != nil {
+		util.Log().Fatalw("Error while creating qontract client", "error", err.Error())
+	}
+	return client
+}
+
+// newLeaseStore creates the state holding the leases used for leader election
+func newLeaseStore(ctx context.Context) (reconcile.LeaseStore, error) {
+	return newStateStore(ctx, "leader-election")
+}
+
+// newHistoryStore creates the state holding the run history of integrations
+func newHistoryStore(ctx context.Context) (reconcile.HistoryStore, error) {
+	return newStateStore(ctx, "run-history")
+}
+
+// newStateStore creates the state of the configured backend, by default the app-interface state bucket
+func newStateStore(ctx context.Context, infix string) (state.Persistence, error) {
+	return state.NewPersistence("state", infix, func() (aws.Client, error) {
+		vc, err := vault.NewVaultClient()
+		if err != nil {
+			return nil, errors.Wrap(err, "Error setting up vault client")
+		}
+		awsSecrets, err := aws.GetAwsCredentials(ctx, vc)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error getting AWS secrets")
+		}
+		awsclient, err := aws.NewClient(ctx, awsSecrets)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error getting AWS client")
+		}
+		return awsclient, nil
+	})
+}
+
+func integrationNames() []string {
+	names := make([]string, 0, len(integrations))
+	for name := range integrations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func validateIntegrationNames(names []string) error {
+	for _, name := range names {
+		if _, ok := integrations[name]; !ok {
+			return fmt.Errorf("unknown integration %s, available integrations: %v", name, integrationNames())
+		}
+	}
+	return nil
+}
+
+func run(names []string) {
+	daemon := reconcile.NewDaemon()
+	daemon.NewLeaseStore = newLeaseStore
+	daemon.NewHistoryStore = newHistoryStore
+	for _, name := range names {
+		daemon.Add(integrations[name](), name)
+	}
+	if daemon.NeedsBundle() {
+		daemon.Bundle = newBundleShaGetter()
+	}
+	daemon.Run()
+}
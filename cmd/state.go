@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/app-sre/go-qontract-reconcile/pkg/reconcile"
+	"github.com/app-sre/go-qontract-reconcile/pkg/state"
+	"github.com/app-sre/go-qontract-reconcile/pkg/util"
+	"github.com/app-sre/go-qontract-reconcile/pkg/vault"
+)
+
+// reencryptState encrypts all state values of the integration name starting with prefix with the current identity
+func reencryptState(name, prefix string) {
+	ctx := context.WithValue(context.Background(), reconcile.ContextIngetrationNameKey, name)
+	vc, err := vault.NewVaultClient()
+	if err != nil {
+		util.Log().Fatalw("Error setting up vault client", "error", err.Error())
+	}
+	store, err := newStateStore(ctx, name)
+	if err != nil {
+		util.Log().Fatalw("Error while creating state", "integration", name, "error", err.Error())
+	}
+	encrypted, err := state.WithEncryption(ctx, store, vc)
+	if err != nil {
+		util.Log().Fatalw("Error while setting up state encryption", "error", err.Error())
+	}
+	encryptedState, ok := encrypted.(*state.EncryptedState)
+	if !ok {
+		util.Log().Fatalw("State encryption is not configured, set state_encryption.vaultpath")
+	}
+	count, err := encryptedState.Reencrypt(ctx, prefix)
+	if err != nil {
+		util.Log().Fatalw("Error while reencrypting state", "integration", name, "reencrypted", count, "error", err.Error())
+	}
+	util.Log().Infow("Reencrypted state", "integration", name, "reencrypted", count)
+}
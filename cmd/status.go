@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/app-sre/go-qontract-reconcile/pkg/reconcile"
+	"github.com/app-sre/go-qontract-reconcile/pkg/util"
+)
+
+func status(name string, asJSON bool) {
+	ctx := context.WithValue(context.Background(), reconcile.ContextIngetrationNameKey, name)
+	store, err := newHistoryStore(ctx)
+	if err != nil {
+		util.Log().Fatalw("Error while creating history store", "error", err.Error())
+	}
+	history, err := reconcile.ReadRunHistory(ctx, store, name)
+	if err != nil {
+		util.Log().Fatalw("Error while reading run history", "integration", name, "error", err.Error())
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(history); err != nil {
+			util.Log().Fatalw("Error while writing run history", "error", err.Error())
+		}
+		return
+	}
+	if len(history.Runs) == 0 {
+		fmt.Printf("No runs recorded for %s\n", history.Integration)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "START\tDURATION\tSTATUS\tBUNDLE\tACTIONS\tERROR")
+	for _, run := range history.Runs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			run.Start.Format(time.RFC3339),
+			run.End.Sub(run.Start).Round(time.Second),
+			run.Status,
+			shortSha(run.BundleSha),
+			formatActions(run.Actions),
+			run.Error)
+	}
+	w.Flush()
+}
+
+func shortSha(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
+
+func formatActions(actions map[reconcile.Action]int) string {
+	formatted := make([]string, 0, len(actions))
+	for action, count := range actions {
+		formatted = append(formatted, fmt.Sprintf("%s=%d", action, count))
+	}
+	sort.Strings(formatted)
+	return strings.Join(formatted, ",")
+}
@@ -43,6 +43,8 @@ type sendEmail func(context.Context, *notify.Notify, string, string) error
 type setFailedState func(context.Context, state.Persistence, string, notification) error
 type rmFailedState func(context.Context, state.Persistence, string) error
 
+var _ reconcile.Planner = &AccountNotifier{}
+
 // AccountNotifier is the account notifier integration used for pgp reencryption
 type AccountNotifier struct {
 	state            state.Persistence
@@ -138,9 +140,24 @@ func (n *AccountNotifier) LogDiff(ri *reconcile.ResourceInventory) {
 	}
 }
 
+// Plan adds the planned notifications to the reconcile plan
+func (n *AccountNotifier) Plan(ri *reconcile.ResourceInventory, plan *reconcile.Plan) {
+	for target := range ri.State {
+		desired := ri.State[target].Desired.(notification)
+		switch desired.Status {
+		case reencrypt:
+			plan.Add(target, reconcile.ActionCreate, desired.SecretPath, fmt.Sprintf("output/%s/%s", desired.Secret.Account, desired.Secret.Username))
+		case notifyExpired:
+			plan.Add(target, reconcile.ActionUpdate, desired.SecretPath, "notify about expired PGP key")
+		default:
+			plan.Add(target, reconcile.ActionNoop, desired.SecretPath, "")
+		}
+	}
+}
+
 // CurrentState lists the secrets from the vault import path and adds them to the resource inventory as current state
-func (n *AccountNotifier) CurrentState(_ context.Context, ri *reconcile.ResourceInventory) error {
-	s, err := n.vault.ListSecrets(n.vaultImportPath)
+func (n *AccountNotifier) CurrentState(ctx context.Context, ri *reconcile.ResourceInventory) error {
+	s, err := n.vault.WithContext(ctx).ListSecrets(n.vaultImportPath)
 	if err != nil {
 		return errors.Wrap(err, fmt.Sprintf("Error while getting list of secrets from import path %s", n.vaultImportPath))
 	}
@@ -148,7 +165,7 @@ func (n *AccountNotifier) CurrentState(_ context.Context, ri *reconcile.Resource
 	for _, secretKey := range s.Keys {
 		secretPath := fmt.Sprintf("%s/%s", n.vaultImportPath, secretKey)
 
-		secret, err := n.vault.ReadSecret(secretPath)
+		secret, err := n.vault.WithContext(ctx).ReadSecret(secretPath)
 		if err != nil {
 			return errors.Wrap(err, fmt.Sprintf("Error while reading secret %s", secretPath))
 		}
@@ -184,6 +201,11 @@ func (n *AccountNotifier) DesiredState(ctx context.Context, ri *reconcile.Resour
 		userMap[user.Org_username] = user
 	}
 
+	// Read all notifications at once, instead of a HEAD and GET per target
+	if err := state.Prefetch(ctx, n.state, ""); err != nil {
+		return errors.Wrap(err, "Error prefetching state")
+	}
+
 	for target, state := range ri.State {
 		user, ok := userMap[target]
 		if !ok {
@@ -275,110 +297,113 @@ Link to userfile: https://gitlab.cee.redhat.com/service/app-interface/-/blob/mas
 `, path)
 }
 
-// Reconcile loop over state and reconcile depending on it.
+// Reconcile loop over state and reconcile depending on it. A failing user does not stop the remaining ones.
 func (n *AccountNotifier) Reconcile(ctx context.Context, ri *reconcile.ResourceInventory) error {
-	for _, state := range ri.State {
-		desired := state.Desired.(notification)
-		if desired.Status == reencrypt {
-			appsrekey, err := n.vault.ReadSecret(n.appSrePGPKeyPath)
-			if err != nil {
-				return errors.Wrap(err, "Error while reading secret from vault")
-			}
-			if appsrekey == nil {
-				return fmt.Errorf("appsre PGP key not found in vault path: %s", n.appSrePGPKeyPath)
-			}
-			armoredOriginalPassword, err := pgp.DecodeAndArmorBase64Entity(desired.Secret.EncyptedPassword, constants.PGPMessageHeader)
-			if err != nil {
-				return errors.Wrap(err, "Error decoding and armoring encrypted password")
-			}
+	return reconcile.ForEachTarget(ctx, ri.State, func(ctx context.Context, _ string, state *reconcile.ResourceState) error {
+		return n.reconcileNotification(ctx, state.Desired.(notification))
+	})
+}
 
-			theActualPassword, err := phelper.DecryptMessageArmored(appsrekey.Data["private_key"].(string),
-				[]byte(appsrekey.Data["passphrase"].(string)), armoredOriginalPassword)
-			if err != nil {
-				return errors.Wrap(err, "Error while decrypting encrypted password")
-			}
-			armoredUserPublicPgpKey, err := pgp.DecodeAndArmorBase64Entity(desired.PublicPgpKey, constants.PublicKeyHeader)
+func (n *AccountNotifier) reconcileNotification(ctx context.Context, desired notification) error {
+	if desired.Status == reencrypt {
+		appsrekey, err := n.vault.WithContext(ctx).ReadSecret(n.appSrePGPKeyPath)
+		if err != nil {
+			return errors.Wrap(err, "Error while reading secret from vault")
+		}
+		if appsrekey == nil {
+			return fmt.Errorf("appsre PGP key not found in vault path: %s", n.appSrePGPKeyPath)
+		}
+		armoredOriginalPassword, err := pgp.DecodeAndArmorBase64Entity(desired.Secret.EncyptedPassword, constants.PGPMessageHeader)
+		if err != nil {
+			return errors.Wrap(err, "Error decoding and armoring encrypted password")
+		}
+
+		theActualPassword, err := phelper.DecryptMessageArmored(appsrekey.Data["private_key"].(string),
+			[]byte(appsrekey.Data["passphrase"].(string)), armoredOriginalPassword)
+		if err != nil {
+			return errors.Wrap(err, "Error while decrypting encrypted password")
+		}
+		armoredUserPublicPgpKey, err := pgp.DecodeAndArmorBase64Entity(desired.PublicPgpKey, constants.PublicKeyHeader)
+		if err != nil {
+			errorWrapped := errors.Wrap(err, "Error while decoding and armoring User Public PGP Key, setting state entry")
+			err = n.setFailedStateFunc(ctx, n.state, desired.Secret.Username, desired)
 			if err != nil {
-				errorWrapped := errors.Wrap(err, "Error while decoding and armoring User Public PGP Key, setting state entry")
-				err = n.setFailedStateFunc(ctx, n.state, desired.Secret.Username, desired)
-				if err != nil {
-					return errors.Wrapf(errorWrapped, "Error while setting state entry for broken Public PGP Key")
-				}
-				return errorWrapped
+				return errors.Wrapf(errorWrapped, "Error while setting state entry for broken Public PGP Key")
 			}
-			armoredReencryptedPassword, err := phelper.EncryptMessageArmored(armoredUserPublicPgpKey, theActualPassword)
+			return errorWrapped
+		}
+		armoredReencryptedPassword, err := phelper.EncryptMessageArmored(armoredUserPublicPgpKey, theActualPassword)
+		if err != nil {
+			errorWrapped := errors.Wrap(err, "Error while encrypting password with User Public PGP Key")
+			err = n.setFailedStateFunc(ctx, n.state, desired.Secret.Username, desired)
 			if err != nil {
-				errorWrapped := errors.Wrap(err, "Error while encrypting password with User Public PGP Key")
-				err = n.setFailedStateFunc(ctx, n.state, desired.Secret.Username, desired)
-				if err != nil {
-					return errors.Wrapf(errorWrapped, "Error while setting state entry for broken Public PGP Key")
-				}
-				return errorWrapped
+				return errors.Wrapf(errorWrapped, "Error while setting state entry for broken Public PGP Key")
 			}
+			return errorWrapped
+		}
 
-			unarmoredReencryptedPassword, err := parmor.Unarmor(armoredReencryptedPassword)
-			if err != nil {
-				errors.Wrap(err, "Error while unarmoring encrypted password")
-			}
+		unarmoredReencryptedPassword, err := parmor.Unarmor(armoredReencryptedPassword)
+		if err != nil {
+			errors.Wrap(err, "Error while unarmoring encrypted password")
+		}
 
-			encodedReencryptedPassword := base64.StdEncoding.EncodeToString(unarmoredReencryptedPassword)
+		encodedReencryptedPassword := base64.StdEncoding.EncodeToString(unarmoredReencryptedPassword)
 
-			// Disable linting for var-naming because we need to be consistent with qontract-reconcile
-			//
-			//revive:disable:var-naming
-			type outputSecret struct {
-				Console_url        string `json:"console_url"`
-				Encrypted_password string `json:"encrypted_password"`
-				Acount             string `json:"account"`
-				User_name          string `json:"user_name"`
-			}
-			//revive:enable:var-naming
+		// Disable linting for var-naming because we need to be consistent with qontract-reconcile
+		//
+		//revive:disable:var-naming
+		type outputSecret struct {
+			Console_url        string `json:"console_url"`
+			Encrypted_password string `json:"encrypted_password"`
+			Acount             string `json:"account"`
+			User_name          string `json:"user_name"`
+		}
+		//revive:enable:var-naming
 
-			output := outputSecret{
-				Console_url:        desired.Secret.ConsoleURL,
-				Encrypted_password: encodedReencryptedPassword,
-				Acount:             desired.Secret.Account,
-				User_name:          desired.Secret.Username,
-			}
+		output := outputSecret{
+			Console_url:        desired.Secret.ConsoleURL,
+			Encrypted_password: encodedReencryptedPassword,
+			Acount:             desired.Secret.Account,
+			User_name:          desired.Secret.Username,
+		}
 
-			err = n.state.Add(ctx, fmt.Sprintf("output/%s/%s", desired.Secret.Account, desired.Secret.Username), output)
-			if err != nil {
-				return errors.Wrap(err, "Error while writing encrypted password to s3")
-			}
+		err = n.state.Add(ctx, fmt.Sprintf("output/%s/%s", desired.Secret.Account, desired.Secret.Username), output)
+		if err != nil {
+			return errors.Wrap(err, "Error while writing encrypted password to s3")
+		}
 
-			_, err = n.vault.DeleteSecret(desired.SecretPath)
-			if err != nil {
-				return errors.Wrap(err, "Error while deleting initial password from vault")
-			}
+		_, err = n.vault.WithContext(ctx).DeleteSecret(desired.SecretPath)
+		if err != nil {
+			return errors.Wrap(err, "Error while deleting initial password from vault")
+		}
 
-			exists, err := n.state.Exists(ctx, desired.Secret.Username)
+		exists, err := n.state.Exists(ctx, desired.Secret.Username)
+		if err != nil {
+			return errors.Wrap(err, "Error while checking state for stale PGP Key existence")
+		}
+		if exists {
+			err = n.rmFailedStateFunc(ctx, n.state, desired.Secret.Username)
 			if err != nil {
-				return errors.Wrap(err, "Error while checking state for stale PGP Key existence")
-			}
-			if exists {
-				err = n.rmFailedStateFunc(ctx, n.state, desired.Secret.Username)
-				if err != nil {
-					return errors.Wrap(err, "Error while deleting statel PGP Key reference from state")
-				}
+				return errors.Wrap(err, "Error while deleting statel PGP Key reference from state")
 			}
+		}
 
-			err = n.sendEmailFunc(ctx, n.newNotifier(desired.Email), "AWS Access provisioned", generateEmail(desired.Secret.ConsoleURL, desired.Secret.Username, encodedReencryptedPassword))
-			if err != nil {
-				return errors.Wrap(err, "Error while sending user notification")
-			}
+		err = n.sendEmailFunc(ctx, n.newNotifier(desired.Email), "AWS Access provisioned", generateEmail(desired.Secret.ConsoleURL, desired.Secret.Username, encodedReencryptedPassword))
+		if err != nil {
+			return errors.Wrap(err, "Error while sending user notification")
+		}
 
+	}
+	if desired.Status == notifyExpired {
+		util.Log().Info("Notification of expired keys to be done")
+		err := n.sendEmailFunc(ctx, n.newNotifier(desired.Email), "Action required: Update PGP key", generateEmailExpired(desired.Secret.Username))
+		if err != nil {
+			return errors.Wrapf(err, "Error while sending user notification")
 		}
-		if desired.Status == notifyExpired {
-			util.Log().Info("Notification of expired keys to be done")
-			err := n.sendEmailFunc(ctx, n.newNotifier(desired.Email), "Action required: Update PGP key", generateEmailExpired(desired.Secret.Username))
-			if err != nil {
-				return errors.Wrapf(err, "Error while sending user notification")
-			}
-			desired.LastNotifiedAt = time.Now()
-			err = n.setFailedStateFunc(ctx, n.state, desired.Secret.Username, desired)
-			if err != nil {
-				return errors.Wrapf(err, "Error while setting state entry for broken Public PGP Key")
-			}
+		desired.LastNotifiedAt = time.Now()
+		err = n.setFailedStateFunc(ctx, n.state, desired.Secret.Username, desired)
+		if err != nil {
+			return errors.Wrapf(err, "Error while setting state entry for broken Public PGP Key")
 		}
 	}
 	return nil
@@ -393,18 +418,27 @@ func (n *AccountNotifier) Setup(ctx context.Context) error {
 		return errors.Wrapf(err, "Error setting up vault client")
 	}
 
-	awsSecrets, err := aws.GetAwsCredentials(ctx, n.vault)
+	n.state, err = state.NewPersistence("state", IntegrationName, func() (aws.Client, error) {
+		awsSecrets, err := aws.GetAwsCredentials(ctx, n.vault)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error getting AWS secrets")
+		}
+
+		awsclient, err := aws.NewClient(ctx, awsSecrets)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error getting AWS client")
+		}
+		return awsclient, nil
+	})
 	if err != nil {
-		return errors.Wrapf(err, "Error getting AWS secrets")
+		return errors.Wrapf(err, "Error setting up state")
 	}
-
-	awsclient, err := aws.NewClient(ctx, awsSecrets)
+	// Notifications contain email addresses and encrypted passwords
+	n.state, err = state.WithEncryption(ctx, n.state, n.vault)
 	if err != nil {
-		return errors.Wrapf(err, "Error getting AWS client")
+		return errors.Wrapf(err, "Error setting up state encryption")
 	}
 
-	n.state = state.NewS3State("state", IntegrationName, awsclient)
-
 	settings, err := n.getReencryptFunc(ctx)
 	if err != nil {
 		return errors.Wrapf(err, "Error getting reencrypt settings")
@@ -420,7 +454,7 @@ func (n *AccountNotifier) Setup(ctx context.Context) error {
 	}
 
 	smtpSettings := allSMTPSettings.GetSettings()[0].GetSmtp()
-	smtpSecret, err := n.vault.ReadSecret(smtpSettings.GetCredentials().Path)
+	smtpSecret, err := n.vault.WithContext(ctx).ReadSecret(smtpSettings.GetCredentials().Path)
 	if err != nil {
 		return errors.Wrapf(err, "Error while reading smtp credentials from vault")
 	}
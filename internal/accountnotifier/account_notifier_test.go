@@ -18,6 +18,7 @@ import (
 	"github.com/app-sre/go-qontract-reconcile/pkg/util"
 	"github.com/app-sre/go-qontract-reconcile/pkg/vault"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/golang/mock/gomock"
 	"github.com/nikoksr/notify"
 	"github.com/stretchr/testify/assert"
@@ -157,7 +158,7 @@ func TestReencryptOkay(t *testing.T) {
 
 	mockClient := mock.NewMockClient(ctrl)
 
-	mockClient.EXPECT().HeadObject(ctx, gomock.Any()).Return(nil, fmt.Errorf("https response error StatusCode: 404")).MaxTimes(2)
+	mockClient.EXPECT().ListObjectsV2(ctx, gomock.Any()).Return(&s3.ListObjectsV2Output{}, nil)
 	mockClient.EXPECT().PutObject(ctx, gomock.Any()).Return(nil, nil).MinTimes(1).MaxTimes(1)
 
 	a := createTestNotifier(v, mockClient, users)
@@ -199,7 +200,7 @@ func TestReencryptOkayWithChecksum(t *testing.T) {
 
 	mockClient := mock.NewMockClient(ctrl)
 
-	mockClient.EXPECT().HeadObject(ctx, gomock.Any()).Return(nil, fmt.Errorf("https response error StatusCode: 404")).MaxTimes(2)
+	mockClient.EXPECT().ListObjectsV2(ctx, gomock.Any()).Return(&s3.ListObjectsV2Output{}, nil)
 	mockClient.EXPECT().PutObject(ctx, gomock.Any()).Return(nil, nil).MinTimes(1).MaxTimes(1)
 
 	a := createTestNotifier(v, mockClient, users)
@@ -241,7 +242,7 @@ func TestReencryptInvalid(t *testing.T) {
 
 	mockClient := mock.NewMockClient(ctrl)
 
-	mockClient.EXPECT().HeadObject(ctx, gomock.Any()).Return(nil, fmt.Errorf("https response error StatusCode: 404")).MaxTimes(2)
+	mockClient.EXPECT().ListObjectsV2(ctx, gomock.Any()).Return(&s3.ListObjectsV2Output{}, nil)
 
 	a := createTestNotifier(v, mockClient, users)
 	a.setFailedStateFunc = func(ctx context.Context, p state.Persistence, s string, n notification) error {
@@ -278,7 +279,9 @@ func TestReencryptUpdated(t *testing.T) {
 
 	mockClient := mock.NewMockClient(ctrl)
 
-	mockClient.EXPECT().HeadObject(ctx, gomock.Any()).Return(nil, nil).MaxTimes(2)
+	mockClient.EXPECT().ListObjectsV2(ctx, gomock.Any()).Return(&s3.ListObjectsV2Output{
+		Contents: []types.Object{{Key: util.StrPointer("state/test/foobar")}},
+	}, nil)
 	mockClient.EXPECT().GetObject(ctx, gomock.Any()).Return(&s3.GetObjectOutput{
 		Body: io.NopCloser(bytes.NewReader([]byte(`{
 "publicpgpkey": "oldone"
@@ -338,7 +341,9 @@ func TestNotifySkip(t *testing.T) {
 	dateByte, err := time.Now().MarshalJSON()
 	assert.NoError(t, err)
 
-	mockClient.EXPECT().HeadObject(ctx, gomock.Any()).Return(nil, nil).MaxTimes(2)
+	mockClient.EXPECT().ListObjectsV2(ctx, gomock.Any()).Return(&s3.ListObjectsV2Output{
+		Contents: []types.Object{{Key: util.StrPointer("state/test/foobar")}},
+	}, nil)
 	mockClient.EXPECT().GetObject(ctx, gomock.Any()).Return(&s3.GetObjectOutput{
 		Body: io.NopCloser(bytes.NewReader([]byte(fmt.Sprintf(`{
 "publicpgpkey": "Invalid key",
@@ -379,7 +384,9 @@ func TestNotifyExpired(t *testing.T) {
 	dateByte, err := time.Date(2020, 1, 1, 1, 1, 1, 1, time.Local).MarshalJSON()
 	assert.NoError(t, err)
 
-	mockClient.EXPECT().HeadObject(ctx, gomock.Any()).Return(nil, nil).MaxTimes(2)
+	mockClient.EXPECT().ListObjectsV2(ctx, gomock.Any()).Return(&s3.ListObjectsV2Output{
+		Contents: []types.Object{{Key: util.StrPointer("state/test/foobar")}},
+	}, nil)
 	mockClient.EXPECT().GetObject(ctx, gomock.Any()).Return(&s3.GetObjectOutput{
 		Body: io.NopCloser(bytes.NewReader([]byte(fmt.Sprintf(`{
 "publicpgpkey": "Invalid key",
@@ -6,14 +6,15 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"os/exec"
 	"strings"
 	"time"
 
 	"github.com/app-sre/go-qontract-reconcile/pkg/aws"
 	"github.com/app-sre/go-qontract-reconcile/pkg/reconcile"
+	"github.com/app-sre/go-qontract-reconcile/pkg/tracing"
 	"github.com/app-sre/go-qontract-reconcile/pkg/util"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 	"github.com/xanzy/go-gitlab"
@@ -31,6 +32,10 @@ type gitPartitionSyncProducerConfig struct {
 	Workdir    string
 }
 
+var _ reconcile.Planner = &GitPartitionSyncProducer{}
+var _ reconcile.Teardowner = &GitPartitionSyncProducer{}
+var _ reconcile.DeletionCounter = &GitPartitionSyncProducer{}
+
 // GitPartitionSyncProducer is the producer integration for the git partition sync
 type GitPartitionSyncProducer struct {
 	config gitPartitionSyncProducerConfig
@@ -91,7 +96,9 @@ func (g *GitPartitionSyncProducer) Setup(ctx context.Context) error {
 		return errors.Wrap(err, "Error while creating workdir")
 	}
 
-	gl, err := gitlab.NewClient(g.config.GlToken, gitlab.WithBaseURL(fmt.Sprintf("%s/api/v4", g.config.GlBaseURL)))
+	gl, err := gitlab.NewClient(g.config.GlToken,
+		gitlab.WithBaseURL(fmt.Sprintf("%s/api/v4", g.config.GlBaseURL)),
+		gitlab.WithHTTPClient(&http.Client{Transport: tracing.Transport(nil)}))
 	if err != nil {
 		return errors.Wrap(err, "Error while creating gitlab client")
 	}
@@ -117,16 +124,14 @@ func (g *GitPartitionSyncProducer) CurrentState(ctx context.Context, ri *reconci
 	ctxTimeout, cancel := context.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 
-	res, err := g.awsClient.ListObjectsV2(ctxTimeout, &s3.ListObjectsV2Input{
-		Bucket: &g.config.Bucket,
-	})
+	objects, err := aws.ListObjects(ctxTimeout, g.awsClient, g.config.Bucket, "")
 	if err != nil {
 		return errors.Wrap(err, "error listing objects in s3")
 	}
 
 	var commitShas = make(map[string][]s3ObjectInfo)
 
-	for _, obj := range res.Contents {
+	for _, obj := range objects {
 		// remove file extension before attempting decode
 		// extension is .tar.age, split at first occurrence of .
 		encodedKey := strings.SplitN(*obj.Key, ".", 2)[0]
@@ -173,7 +178,7 @@ func (g *GitPartitionSyncProducer) DesiredState(ctx context.Context, ri *reconci
 			if len(sync.GetDestinationProject().Group) != 0 {
 				sourcePid := fmt.Sprintf("%s/%s", sync.GetSourceProject().Group, sync.GetSourceProject().Name)
 				targetPid := fmt.Sprintf("%s/%s", sync.GetDestinationProject().Group, sync.GetDestinationProject().Name)
-				commit, _, err := g.glClient.Commits.GetCommit(sourcePid, sync.SourceProject.Branch, nil)
+				commit, _, err := g.glClient.Commits.GetCommit(sourcePid, sync.SourceProject.Branch, nil, gitlab.WithContext(ctx))
 				if err != nil {
 					return errors.Wrap(err, "Error while getting commit")
 				}
@@ -222,70 +227,69 @@ type syncConfig struct {
 	DestinationBranch       string
 }
 
-// Reconcile syncs the repositories to S3 that have changed since the last run
+// Reconcile syncs the repositories to S3 that have changed since the last run. A failing repository does not stop the remaining ones.
 func (g *GitPartitionSyncProducer) Reconcile(ctx context.Context, ri *reconcile.ResourceInventory) error {
-	defer g.clear()
+	return reconcile.ForEachTarget(ctx, ri.State, g.reconcileTarget)
+}
 
-	for targetPid := range ri.State {
-		util.Log().Debugw("Reconciling target", "target", targetPid)
-		state := ri.GetResourceState(targetPid)
-		var current *currentState
-		var desired *s3ObjectInfo
-		if state.Current != nil {
-			current = state.Current.(*currentState)
-		}
-		if state.Desired != nil {
-			desired = state.Desired.(*s3ObjectInfo)
+func (g *GitPartitionSyncProducer) reconcileTarget(ctx context.Context, targetPid string, state *reconcile.ResourceState) error {
+	util.Log().Debugw("Reconciling target", "target", targetPid)
+	var current *currentState
+	var desired *s3ObjectInfo
+	if state.Current != nil {
+		current = state.Current.(*currentState)
+	}
+	if state.Desired != nil {
+		desired = state.Desired.(*s3ObjectInfo)
+	}
+	// if config is nil, we don't need to sync the repo and jump to cleanup
+	if state.Config != nil && needsUpdate(current, desired) {
+		sync := state.Config.(GetGitlabSyncAppsApps_v1App_v1CodeComponentsAppCodeComponents_v1GitlabSyncCodeComponentGitlabSync_v1)
+		syncConfig := syncConfig{
+			SourceProjectName:       sync.SourceProject.Name,
+			SourceProjectGroup:      sync.SourceProject.Group,
+			SourceBranch:            sync.SourceProject.Branch,
+			DestinationProjectName:  sync.DestinationProject.Name,
+			DestinationProjectGroup: sync.DestinationProject.Group,
+			DestinationBranch:       sync.DestinationProject.Branch,
 		}
-		// if config is nil, we don't need to sync the repo and jump to cleanup
-		if state.Config != nil && needsUpdate(current, desired) {
-			sync := state.Config.(GetGitlabSyncAppsApps_v1App_v1CodeComponentsAppCodeComponents_v1GitlabSyncCodeComponentGitlabSync_v1)
-			syncConfig := syncConfig{
-				SourceProjectName:       sync.SourceProject.Name,
-				SourceProjectGroup:      sync.SourceProject.Group,
-				SourceBranch:            sync.SourceProject.Branch,
-				DestinationProjectName:  sync.DestinationProject.Name,
-				DestinationProjectGroup: sync.DestinationProject.Group,
-				DestinationBranch:       sync.DestinationProject.Branch,
-			}
-			util.Log().Infow("Updating repo", "repo", targetPid)
+		util.Log().Infow("Updating repo", "repo", targetPid)
 
-			util.Log().Debugw("Cloning repo", "repo", targetPid)
-			repoPath, err := g.cloneRepos(syncConfig)
-			if err != nil {
-				return errors.Wrapf(err, "Error while cloning repo %s", targetPid)
-			}
+		util.Log().Debugw("Cloning repo", "repo", targetPid)
+		repoPath, err := g.cloneRepos(syncConfig)
+		if err != nil {
+			return errors.Wrapf(err, "Error while cloning repo %s", targetPid)
+		}
 
-			util.Log().Debugw("Tarring repo", "repo", targetPid)
-			tarPath, err := g.tarRepos(repoPath, syncConfig)
-			if err != nil {
-				return errors.Wrapf(err, "Error while tarring repo %s", targetPid)
-			}
+		util.Log().Debugw("Tarring repo", "repo", targetPid)
+		tarPath, err := g.tarRepos(repoPath, syncConfig)
+		if err != nil {
+			return errors.Wrapf(err, "Error while tarring repo %s", targetPid)
+		}
 
-			util.Log().Debugw("Encrypting repo", "repo", targetPid)
-			encryptPath, err := g.encryptRepoTars(tarPath, syncConfig)
-			if err != nil {
-				return errors.Wrapf(err, "Error while encrypting repo %s", targetPid)
-			}
+		util.Log().Debugw("Encrypting repo", "repo", targetPid)
+		encryptPath, err := g.encryptRepoTars(tarPath, syncConfig)
+		if err != nil {
+			return errors.Wrapf(err, "Error while encrypting repo %s", targetPid)
+		}
 
-			util.Log().Debugw("Uploading repo", "repo", targetPid)
-			err = g.uploadLatest(ctx, encryptPath, desired.CommitSHA, syncConfig)
-			if err != nil {
-				return errors.Wrapf(err, "Error while uploading repo %s", targetPid)
-			}
+		util.Log().Debugw("Uploading repo", "repo", targetPid)
+		err = g.uploadLatest(ctx, encryptPath, desired.CommitSHA, syncConfig)
+		if err != nil {
+			return errors.Wrapf(err, "Error while uploading repo %s", targetPid)
 		}
+	}
 
-		// Current is not nil means, there are old objects in S3, thus we need to check if objects need to be removed
-		// this also handles the case where the repo is not in app-interface, thus we need to clean up the old objects
-		if current != nil {
-			for _, s3ObjectInfo := range current.S3ObjectInfos {
-				if desired == nil || s3ObjectInfo.CommitSHA != desired.CommitSHA {
-					util.Log().Debugw("Removing outdated s3 object", "s3ObjectInfo", s3ObjectInfo)
-					err := g.removeOutdated(ctx, s3ObjectInfo.Key)
-					if err != nil {
-						util.Log().Info("Deleting outdated s3 object")
-						return errors.Wrap(err, "Error while removing outdated s3 object")
-					}
+	// Current is not nil means, there are old objects in S3, thus we need to check if objects need to be removed
+	// this also handles the case where the repo is not in app-interface, thus we need to clean up the old objects
+	if current != nil {
+		for _, s3ObjectInfo := range current.S3ObjectInfos {
+			if desired == nil || s3ObjectInfo.CommitSHA != desired.CommitSHA {
+				util.Log().Debugw("Removing outdated s3 object", "s3ObjectInfo", s3ObjectInfo)
+				err := g.removeOutdated(ctx, s3ObjectInfo.Key)
+				if err != nil {
+					util.Log().Info("Deleting outdated s3 object")
+					return errors.Wrap(err, "Error while removing outdated s3 object")
 				}
 			}
 		}
@@ -317,6 +321,53 @@ func (g *GitPartitionSyncProducer) LogDiff(ri *reconcile.ResourceInventory) {
 	}
 }
 
+// Plan adds the planned uploads and deletions to the reconcile plan
+func (g *GitPartitionSyncProducer) Plan(ri *reconcile.ResourceInventory, plan *reconcile.Plan) {
+	for target := range ri.State {
+		state := ri.GetResourceState(target)
+
+		var current *currentState
+		var desired *s3ObjectInfo
+		var before, after string
+
+		if state.Current != nil {
+			current = state.Current.(*currentState)
+			commitShas := []string{}
+			for _, s3ObjectInfo := range current.S3ObjectInfos {
+				commitShas = append(commitShas, s3ObjectInfo.CommitSHA)
+			}
+			before = strings.Join(commitShas, ",")
+		}
+		if state.Desired != nil {
+			desired = state.Desired.(*s3ObjectInfo)
+			after = desired.CommitSHA
+		}
+
+		switch {
+		case state.Config != nil && current == nil:
+			plan.Add(target, reconcile.ActionCreate, before, after)
+		case state.Config != nil && needsUpdate(current, desired):
+			plan.Add(target, reconcile.ActionUpdate, before, after)
+		case state.Config == nil && state.Desired == nil && current != nil:
+			plan.Add(target, reconcile.ActionDelete, before, after)
+		default:
+			plan.Add(target, reconcile.ActionNoop, before, after)
+		}
+	}
+}
+
+// PlannedDeletions counts the targets, whose S3 objects are all removed by Reconcile. Outdated objects of targets,
+// that get a new upload, are not counted.
+func (g *GitPartitionSyncProducer) PlannedDeletions(ri *reconcile.ResourceInventory, _ *reconcile.Plan) int {
+	deletions := 0
+	for _, state := range ri.State {
+		if state.Current != nil && state.Desired == nil {
+			deletions++
+		}
+	}
+	return deletions
+}
+
 func (g *GitPartitionSyncProducer) clean(directory string) error {
 	cmd := exec.Command("rm", "-rf", directory)
 	cmd.Dir = g.config.Workdir
@@ -333,6 +384,11 @@ func (g *GitPartitionSyncProducer) clean(directory string) error {
 	return nil
 }
 
+// Teardown removes clones, tarballs and encrypted files from the working directory
+func (g *GitPartitionSyncProducer) Teardown(_ context.Context) error {
+	return errors.Wrap(g.clear(), "Error while clearing workdir")
+}
+
 // clear all items in working directory
 func (g *GitPartitionSyncProducer) clear() error {
 	cmd := exec.Command("rm", "-rf", encryptDirectory, tarDirectory, cloneDirectory)
@@ -2,6 +2,8 @@ package producer
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -9,6 +11,7 @@ import (
 
 	"github.com/app-sre/go-qontract-reconcile/pkg/aws/mock"
 	"github.com/app-sre/go-qontract-reconcile/pkg/reconcile"
+	"github.com/app-sre/go-qontract-reconcile/pkg/reconcile/reconciletest"
 	"github.com/app-sre/go-qontract-reconcile/pkg/util"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/xanzy/go-gitlab"
@@ -216,3 +219,113 @@ func TestReconcileOrphanedObjects(t *testing.T) {
 	producer := createTestProducer(mockClient, "")
 	producer.Reconcile(ctx, ri)
 }
+
+func TestPlan(t *testing.T) {
+	ri := reconcile.NewResourceInventory()
+	ri.AddResourceState("new/project", &reconcile.ResourceState{
+		Config:  GetGitlabSyncAppsApps_v1App_v1CodeComponentsAppCodeComponents_v1GitlabSyncCodeComponentGitlabSync_v1{},
+		Desired: &s3ObjectInfo{CommitSHA: "b"},
+	})
+	ri.AddResourceState("changed/project", &reconcile.ResourceState{
+		Config:  GetGitlabSyncAppsApps_v1App_v1CodeComponentsAppCodeComponents_v1GitlabSyncCodeComponentGitlabSync_v1{},
+		Current: &currentState{S3ObjectInfos: []s3ObjectInfo{{CommitSHA: "a"}}},
+		Desired: &s3ObjectInfo{CommitSHA: "b"},
+	})
+	ri.AddResourceState("same/project", &reconcile.ResourceState{
+		Config:  GetGitlabSyncAppsApps_v1App_v1CodeComponentsAppCodeComponents_v1GitlabSyncCodeComponentGitlabSync_v1{},
+		Current: &currentState{S3ObjectInfos: []s3ObjectInfo{{CommitSHA: "b"}}},
+		Desired: &s3ObjectInfo{CommitSHA: "b"},
+	})
+	ri.AddResourceState("orphan/project", &reconcile.ResourceState{
+		Current: &currentState{S3ObjectInfos: []s3ObjectInfo{{CommitSHA: "a"}, {CommitSHA: "c"}}},
+	})
+
+	producer := createTestProducer(nil, "")
+	plan := reconcile.NewPlan("test")
+	producer.Plan(ri, plan)
+
+	actions := map[string]reconcile.PlanEntry{}
+	for _, e := range plan.Entries {
+		actions[e.Target] = e
+	}
+	assert.Equal(t, reconcile.ActionCreate, actions["new/project"].Action)
+	assert.Equal(t, reconcile.ActionUpdate, actions["changed/project"].Action)
+	assert.Equal(t, "a", actions["changed/project"].Before)
+	assert.Equal(t, "b", actions["changed/project"].After)
+	assert.Equal(t, reconcile.ActionNoop, actions["same/project"].Action)
+	assert.Equal(t, reconcile.ActionDelete, actions["orphan/project"].Action)
+	assert.Equal(t, "a,c", actions["orphan/project"].Before)
+	assert.Equal(t, 1, producer.PlannedDeletions(ri, plan))
+}
+
+func TestReconcileContinuesAfterFailedTarget(t *testing.T) {
+	ctx := context.Background()
+	ri := reconcile.NewResourceInventory()
+	ri.AddResourceState("orphan/a", &reconcile.ResourceState{
+		Current: &currentState{
+			S3ObjectInfos: []s3ObjectInfo{
+				{CommitSHA: "a", Key: util.StrPointer("orphan_a/a")},
+			},
+		},
+	})
+	ri.AddResourceState("orphan/b", &reconcile.ResourceState{
+		Current: &currentState{
+			S3ObjectInfos: []s3ObjectInfo{
+				{CommitSHA: "b", Key: util.StrPointer("orphan_b/b")},
+			},
+		},
+	})
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mock.NewMockClient(ctrl)
+	mockClient.EXPECT().DeleteObject(gomock.Any(), &s3.DeleteObjectInput{Bucket: util.StrPointer(""), Key: util.StrPointer("orphan_a/a")}).Return(nil, fmt.Errorf("access denied"))
+	mockClient.EXPECT().DeleteObject(gomock.Any(), &s3.DeleteObjectInput{Bucket: util.StrPointer(""), Key: util.StrPointer("orphan_b/b")}).Return(nil, nil)
+	producer := createTestProducer(mockClient, "")
+
+	err := producer.Reconcile(ctx, ri)
+	assert.ErrorContains(t, err, "orphan/a")
+	assert.NotContains(t, err.Error(), "orphan/b")
+}
+
+func encodeTestKey(t *testing.T, group, project, sha string) *string {
+	b, err := json.Marshal(decodedKey{Group: group, ProjectName: project, CommitSHA: sha})
+	assert.NoError(t, err)
+	return util.StrPointer(base64.StdEncoding.EncodeToString(b) + ".tar.age")
+}
+
+func TestLifecycle(t *testing.T) {
+	reconciletest.NewFakeGraphQL(t, map[string]interface{}{
+		"GetGitlabSyncApps": map[string]interface{}{
+			"apps_v1": []interface{}{map[string]interface{}{
+				"codeComponents": []interface{}{map[string]interface{}{
+					"gitlabSync": map[string]interface{}{
+						"__typename":         "CodeComponentGitlabSync_v1",
+						"sourceProject":      map[string]interface{}{"__typename": "CodeComponentGitlabSyncProject_v1", "name": "project", "group": "test", "branch": "main"},
+						"destinationProject": map[string]interface{}{"__typename": "CodeComponentGitlabSyncProject_v1", "name": "project", "group": "dest", "branch": "main"},
+					},
+				}},
+			}},
+		},
+	})
+	gitlabMock := setupGitlabMock()
+	defer gitlabMock.Close()
+
+	awsMock := reconciletest.NewAWSMock(t)
+	awsMock.EXPECT().ListObjectsV2(gomock.Any(), gomock.Any()).Return(&s3.ListObjectsV2Output{
+		Contents: []types.Object{
+			{Key: encodeTestKey(t, "dest", "project", "old_sha")},
+			{Key: encodeTestKey(t, "orphan", "project", "orphan_sha")},
+		},
+	}, nil)
+
+	producer := createTestProducer(awsMock, gitlabMock.URL)
+	producer.getGitlabSyncAppsFunc = NewGitPartitionSyncProducer().getGitlabSyncAppsFunc
+
+	result := reconciletest.Run(t, producer, reconciletest.Options{
+		Name:      "git-partition-sync-producer",
+		SkipSetup: true,
+		DryRun:    true,
+	})
+	assert.NoError(t, result.Err)
+	result.AssertGolden(t, "lifecycle")
+}
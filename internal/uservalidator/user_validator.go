@@ -74,7 +74,7 @@ func (i *ValidateUser) Setup(ctx context.Context) error {
 			tokenField = org.GetToken().Field
 		}
 	}
-	secret, err := i.Vc.ReadSecret(tokenPath)
+	secret, err := i.Vc.WithContext(ctx).ReadSecret(tokenPath)
 	if err != nil {
 		return err
 	}
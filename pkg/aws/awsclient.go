@@ -5,12 +5,17 @@ package aws
 import (
 	"context"
 
+	"github.com/app-sre/go-qontract-reconcile/pkg/tracing"
 	"github.com/app-sre/go-qontract-reconcile/pkg/util"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 //go:generate go run github.com/Khan/genqlient
@@ -46,26 +51,63 @@ type awsClient struct {
 	s3Client s3.Client
 }
 
-func (c *awsClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+func (c *awsClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (out *s3.GetObjectOutput, err error) {
+	ctx, span := startS3Span(ctx, "GetObject", params.Bucket, params.Key)
+	defer func() { tracing.End(span, err) }()
 	return c.s3Client.GetObject(ctx, params, optFns...)
 }
 
-func (c *awsClient) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+func (c *awsClient) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (out *s3.HeadObjectOutput, err error) {
+	ctx, span := startS3Span(ctx, "HeadObject", params.Bucket, params.Key)
+	defer func() { tracing.End(span, err) }()
 	return c.s3Client.HeadObject(ctx, params, optFns...)
 }
 
-func (c *awsClient) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+func (c *awsClient) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (out *s3.PutObjectOutput, err error) {
+	ctx, span := startS3Span(ctx, "PutObject", params.Bucket, params.Key)
+	defer func() { tracing.End(span, err) }()
 	return c.s3Client.PutObject(ctx, params, optFns...)
 }
 
-func (c *awsClient) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+func (c *awsClient) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (out *s3.DeleteObjectOutput, err error) {
+	ctx, span := startS3Span(ctx, "DeleteObject", params.Bucket, params.Key)
+	defer func() { tracing.End(span, err) }()
 	return c.s3Client.DeleteObject(ctx, params, optFns...)
 }
 
-func (c *awsClient) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+func (c *awsClient) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (out *s3.ListObjectsV2Output, err error) {
+	ctx, span := startS3Span(ctx, "ListObjectsV2", params.Bucket, params.Prefix)
+	defer func() { tracing.End(span, err) }()
 	return c.s3Client.ListObjectsV2(ctx, params, optFns...)
 }
 
+// ListObjects lists all objects in bucket starting with prefix, it follows continuation tokens of ListObjectsV2
+func ListObjects(ctx context.Context, c Client, bucket, prefix string) ([]types.Object, error) {
+	input := &s3.ListObjectsV2Input{Bucket: &bucket}
+	if prefix != "" {
+		input.Prefix = &prefix
+	}
+	objects := []types.Object{}
+	for {
+		page, err := c.ListObjectsV2(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, page.Contents...)
+		if !aws.ToBool(page.IsTruncated) || aws.ToString(page.NextContinuationToken) == "" {
+			return objects, nil
+		}
+		input.ContinuationToken = page.NextContinuationToken
+	}
+}
+
+// startS3Span starts a span for the S3 operation op on bucket and key
+func startS3Span(ctx context.Context, op string, bucket, key *string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "s3 "+op,
+		attribute.String("aws.s3.bucket", aws.ToString(bucket)),
+		attribute.String("aws.s3.key", aws.ToString(key)))
+}
+
 type awsClientConfig struct {
 	Region string
 }
@@ -66,7 +66,7 @@ func GetAwsCredentials(ctx context.Context, vc *vault.Client) (*Credentials, err
 	if err != nil {
 		return nil, errors.Wrap(err, "Error getting AWS account info")
 	}
-	return getCredentialsFromVault(vc, accounts)
+	return getCredentialsFromVault(vc.WithContext(ctx), accounts)
 }
 
 func guessAccountName() string {
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/app-sre/go-qontract-reconcile/pkg/tracing"
 	"github.com/app-sre/go-qontract-reconcile/pkg/util"
 	"github.com/google/go-github/v42/github"
 	"github.com/spf13/viper"
@@ -44,6 +45,7 @@ func NewAuthenticatedGithubClient(ctx context.Context, token string) (*Authentic
 		&oauth2.Token{AccessToken: token},
 	)
 	tc := oauth2.NewClient(ctx, ts)
+	tc.Transport = tracing.Transport(tc.Transport)
 	tc.Timeout = time.Duration(config.Timeout) * time.Second
 
 	client := github.NewClient(tc)
@@ -4,15 +4,18 @@ package gql
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/Khan/genqlient/graphql"
 	"github.com/app-sre/go-qontract-reconcile/pkg/reconcile"
+	"github.com/app-sre/go-qontract-reconcile/pkg/tracing"
 	"github.com/app-sre/go-qontract-reconcile/pkg/util"
 	"github.com/hashicorp/go-retryablehttp"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
@@ -39,6 +42,7 @@ type QontractClient struct {
 	Client        graphql.Client
 	CompareClinet *graphql.Client
 	config        *qontractConfig
+	httpClient    *retryableHTTPWrapper
 }
 
 type qontractConfig struct {
@@ -81,8 +85,9 @@ func NewQontractClient(_ context.Context) (*QontractClient, error) {
 		})
 	}
 	client := &QontractClient{
-		Client: graphql.NewClient(config.Server, retryClient),
-		config: config,
+		Client:     graphql.NewClient(config.Server, retryClient),
+		config:     config,
+		httpClient: retryClient,
 	}
 
 	if len(config.CompareSha) > 0 {
@@ -115,7 +120,10 @@ func (c *QontractClient) ensureSchema(integrationName string, resp *graphql.Resp
 }
 
 // MakeRequest makes a request to graphql server, ensuring schema usage is allowed
-func (c *QontractClient) MakeRequest(ctx context.Context, req *graphql.Request, resp *graphql.Response) error {
+func (c *QontractClient) MakeRequest(ctx context.Context, req *graphql.Request, resp *graphql.Response) (err error) {
+	ctx, span := tracing.Start(ctx, "graphql "+req.OpName, attribute.String("graphql.operation.name", req.OpName))
+	defer func() { tracing.End(span, err) }()
+
 	var client graphql.Client
 	useCompare := ctx.Value(UseCompareClientKey)
 	if useCompare != nil && useCompare.(bool) == true {
@@ -126,7 +134,7 @@ func (c *QontractClient) MakeRequest(ctx context.Context, req *graphql.Request,
 	} else {
 		client = c.Client
 	}
-	err := client.MakeRequest(ctx, req, resp)
+	err = client.MakeRequest(ctx, req, resp)
 	if err != nil {
 		return err
 	}
@@ -142,6 +150,27 @@ func (c *QontractClient) MakeRequest(ctx context.Context, req *graphql.Request,
 	return nil
 }
 
+// BundleSha returns the SHA256 of the bundle currently served by qontract-server
+func (c *QontractClient) BundleSha(ctx context.Context) (string, error) {
+	req, err := retryablehttp.NewRequestWithContext(ctx, http.MethodGet, strings.ReplaceAll(c.config.Server, "/graphql", "/sha256"), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.httpClient.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d while getting bundle sha", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
 type zapLog struct {
 	z *zap.SugaredLogger
 }
@@ -177,3 +177,20 @@ func TestSchemaOkay(t *testing.T) {
 	)
 	assert.Nil(t, err)
 }
+
+func TestBundleSha(t *testing.T) {
+	mock := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/sha256", r.URL.Path)
+			w.Write([]byte("abc123\n"))
+		}))
+	qontractSetupViper()
+	os.Setenv("GRAPHQL_SERVER", mock.URL+"/graphql")
+	os.Setenv("GRAPHQL_RETRIES", "0")
+
+	client, err := NewQontractClient(testContext)
+	assert.Nil(t, err)
+	sha, err := client.BundleSha(testContext)
+	assert.Nil(t, err)
+	assert.Equal(t, "abc123", sha)
+}
@@ -0,0 +1,7 @@
+// Package metrics holds the Prometheus registry for metrics of packages used by integrations
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Registry collects metrics of packages used by integrations, i.e. state, the runner serves it next to its own metrics
+var Registry = prometheus.NewRegistry()
@@ -0,0 +1,68 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyIntegration fails the first failures runs and cancels stop on the first successful one
+type flakyIntegration struct {
+	TestIntegration
+	failures int
+	runs     int
+	stop     context.CancelFunc
+}
+
+func (f *flakyIntegration) Reconcile(context.Context, *ResourceInventory) error {
+	f.runs++
+	if f.runs <= f.failures {
+		return errors.New("flaky")
+	}
+	f.stop()
+	return nil
+}
+
+func withMaxFailures(maxFailures int) testRunnerOption {
+	return withConfig(&runnerConfig{
+		SleepDurationSecs:      600,
+		MaxConsecutiveFailures: maxFailures,
+	})
+}
+
+func TestLoopRecoversAfterFailures(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	integration := &flakyIntegration{failures: 2, stop: cancel}
+	runner := newTestRunner(t, integration, withMaxFailures(3))
+
+	assert.Equal(t, 0, runner.loop(ctx))
+	assert.Equal(t, 3, integration.runs)
+	assert.Equal(t, 0.0, testutil.ToFloat64(runner.metrics.failures))
+	assert.Equal(t, 2.0, testutil.ToFloat64(runner.metrics.triggers.WithLabelValues(triggerReasonBackoff)))
+}
+
+func TestLoopExitsAfterConsecutiveFailures(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	integration := &flakyIntegration{failures: 10, stop: cancel}
+	runner := newTestRunner(t, integration, withMaxFailures(3))
+
+	assert.Equal(t, 1, runner.loop(ctx))
+	assert.Equal(t, 3, integration.runs)
+	assert.Equal(t, 3.0, testutil.ToFloat64(runner.metrics.failures))
+}
+
+func TestLoopRetriesForeverWithoutFailureLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	integration := &flakyIntegration{failures: 5, stop: cancel}
+	runner := newTestRunner(t, integration, withMaxFailures(0))
+
+	assert.Equal(t, 0, runner.loop(ctx))
+	assert.Equal(t, 6, integration.runs)
+	assert.Equal(t, 5.0, testutil.ToFloat64(runner.metrics.triggers.WithLabelValues(triggerReasonBackoff)))
+}
@@ -0,0 +1,81 @@
+package reconcile
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/app-sre/go-qontract-reconcile/pkg/util"
+)
+
+// ReportFormatBaseline writes validation errors as baseline, to accept all current findings
+const ReportFormatBaseline = "baseline"
+
+// baselineEntry identifies an accepted finding, the message is hashed to keep the baseline free of secrets
+type baselineEntry struct {
+	Path        string `json:"path"`
+	Validation  string `json:"validation"`
+	MessageHash string `json:"messageHash"`
+}
+
+type baseline struct {
+	Entries []baselineEntry `json:"entries"`
+}
+
+func newBaselineEntry(e ValidationError) baselineEntry {
+	hash := sha256.Sum256([]byte(e.Error.Error()))
+	return baselineEntry{
+		Path:        e.Path,
+		Validation:  e.Validation,
+		MessageHash: hex.EncodeToString(hash[:]),
+	}
+}
+
+func readBaseline(path string) (map[baselineEntry]bool, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var b baseline
+	if err := json.Unmarshal(content, &b); err != nil {
+		return nil, err
+	}
+	entries := make(map[baselineEntry]bool, len(b.Entries))
+	for _, entry := range b.Entries {
+		entries[entry] = true
+	}
+	return entries, nil
+}
+
+// filterBaseline removes all findings of the configured baseline from validationErrors
+func (v *ValidationRunner) filterBaseline(validationErrors []ValidationError) ([]ValidationError, error) {
+	if v.config.ValidationBaseline == "" {
+		return validationErrors, nil
+	}
+	accepted, err := readBaseline(v.config.ValidationBaseline)
+	if err != nil {
+		return nil, err
+	}
+	filtered := []ValidationError{}
+	for _, e := range validationErrors {
+		if !accepted[newBaselineEntry(e)] {
+			filtered = append(filtered, e)
+		}
+	}
+	if suppressed := len(validationErrors) - len(filtered); suppressed > 0 {
+		util.Log().Infow("Suppressed findings of the validation baseline", "suppressed", suppressed)
+	}
+	return filtered, nil
+}
+
+func writeBaselineReport(w io.Writer, _ string, validationErrors []ValidationError) error {
+	b := baseline{Entries: []baselineEntry{}}
+	for _, e := range validationErrors {
+		b.Entries = append(b.Entries, newBaselineEntry(e))
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(b)
+}
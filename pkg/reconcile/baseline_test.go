@@ -0,0 +1,81 @@
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// staticValidation returns the same findings on every run
+type staticValidation struct {
+	findings []ValidationError
+}
+
+func (s *staticValidation) Setup(context.Context) error { return nil }
+
+func (s *staticValidation) Validate(context.Context) ([]ValidationError, error) {
+	return s.findings, nil
+}
+
+func runStaticValidation(findings []ValidationError, config *runnerConfig) int {
+	vr := NewValidationRunner(&staticValidation{findings: findings}, "test")
+	vr.config = config
+	exitCode := 0
+	vr.Exiter = func(i int) {
+		exitCode = i
+	}
+	vr.Run()
+	return exitCode
+}
+
+func TestValidationRunnerSeverities(t *testing.T) {
+	assert.Equal(t, 0, runStaticValidation(testSeverityValidationErrors[1:], &runnerConfig{}))
+	assert.Equal(t, 1, runStaticValidation(testSeverityValidationErrors, &runnerConfig{}))
+	assert.Equal(t, 1, runStaticValidation([]ValidationError{{Error: fmt.Errorf("unknown"), Severity: "critical"}}, &runnerConfig{}))
+}
+
+func TestValidationRunnerBaseline(t *testing.T) {
+	dir := t.TempDir()
+	baselinePath := filepath.Join(dir, "baseline.json")
+	reportPath := filepath.Join(dir, "report.json")
+
+	// Accept all current findings
+	assert.Equal(t, 1, runStaticValidation(testValidationErrors, &runnerConfig{
+		ValidationReports: []string{"baseline:" + baselinePath},
+	}))
+	content, err := os.ReadFile(baselinePath)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(content), "invalid key")
+
+	config := &runnerConfig{
+		ValidationBaseline: baselinePath,
+		ValidationReports:  []string{"json:" + reportPath, "baseline:" + filepath.Join(dir, "new-baseline.json")},
+	}
+	assert.Equal(t, 0, runStaticValidation(testValidationErrors, config))
+
+	// A changed message is a new finding
+	changed := []ValidationError{
+		testValidationErrors[0],
+		{Path: "/users/bar.yml", Validation: "validate_github_login", Error: fmt.Errorf("login renamed")},
+	}
+	assert.Equal(t, 1, runStaticValidation(changed, config))
+	report, err := os.ReadFile(reportPath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(report), "login renamed")
+	assert.NotContains(t, string(report), "invalid key")
+
+	// The baseline report contains suppressed findings too
+	newBaseline, err := readBaseline(filepath.Join(dir, "new-baseline.json"))
+	assert.NoError(t, err)
+	assert.Len(t, newBaseline, 2)
+	assert.True(t, newBaseline[newBaselineEntry(testValidationErrors[0])])
+}
+
+func TestValidationRunnerMissingBaseline(t *testing.T) {
+	config := &runnerConfig{ValidationBaseline: filepath.Join(t.TempDir(), "missing.json")}
+	assert.Equal(t, 1, runStaticValidation([]ValidationError{}, config))
+}
@@ -0,0 +1,107 @@
+package reconcile
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/app-sre/go-qontract-reconcile/pkg/tracing"
+	"github.com/app-sre/go-qontract-reconcile/pkg/util"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Daemon runs multiple Integrations in a single process. Every Integration runs on its own
+// schedule, metrics and health probes of all Integrations are served by one server.
+type Daemon struct {
+	Exiter   exitFunc
+	config   *runnerConfig
+	registry *prometheus.Registry
+	runners  []*IntegrationRunner
+	// Bundle is used by all Integrations in the bundle trigger mode
+	Bundle BundleShaGetter
+	// NewLeaseStore is used by all Integrations with leader election
+	NewLeaseStore func(ctx context.Context) (LeaseStore, error)
+	// NewHistoryStore is used by all Integrations to persist their run history
+	NewHistoryStore func(ctx context.Context) (HistoryStore, error)
+}
+
+// NewDaemon creates a Daemon without any Integrations
+func NewDaemon() *Daemon {
+	return &Daemon{
+		Exiter: func(exitCode int) {
+			util.Log().Debugw("Exiting", "exitCode", exitCode)
+			tracing.Shutdown(context.Background())
+			os.Exit(exitCode)
+		},
+		config:   newRunnerConfig(),
+		registry: prometheus.NewRegistry(),
+	}
+}
+
+// Add adds an Integration to the Daemon, its settings can be overridden in the integrations.<name> section
+func (d *Daemon) Add(runnable Integration, name string) {
+	d.runners = append(d.runners, newIntegrationRunner(runnable, name, newIntegrationRunnerConfig(name), d.registry))
+}
+
+// NeedsBundle reports if any of the Integrations uses Bundle
+func (d *Daemon) NeedsBundle() bool {
+	for _, r := range d.runners {
+		if r.NeedsBundle() {
+			return true
+		}
+	}
+	return false
+}
+
+// Run runs all Integrations until SIGINT or SIGTERM is received or one of them fails
+func (d *Daemon) Run() {
+	signalCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	// A failing Integration stops all others, just like a failing IntegrationRunner exits the process
+	loopCtx, cancel := context.WithCancel(signalCtx)
+	defer cancel()
+
+	health := healthGroup{}
+	for _, r := range d.runners {
+		if r.Bundle == nil {
+			r.Bundle = d.Bundle
+		}
+		if r.NewLeaseStore == nil {
+			r.NewLeaseStore = d.NewLeaseStore
+		}
+		if r.NewHistoryStore == nil {
+			r.NewHistoryStore = d.NewHistoryStore
+		}
+		if err := r.setupLoop(); err != nil {
+			util.Log().Errorw("Error while setting up runner", "integration", r.Name, "error", err.Error())
+			d.Exiter(1)
+			return
+		}
+		health = append(health, r.health)
+	}
+	server := startServer(d.config.PrometheusPort, d.registry, health)
+	triggerServer := startTriggerServer(d.config.TriggerAddress, d.runners...)
+
+	exitCodes := make(chan int, len(d.runners))
+	for _, r := range d.runners {
+		go func(r *IntegrationRunner) {
+			exitCode := r.loop(loopCtx)
+			if exitCode != 0 {
+				util.Log().Errorw("Integration failed, stopping all integrations", "integration", r.Name)
+				cancel()
+			}
+			exitCodes <- exitCode
+		}(r)
+	}
+
+	exitCode := 0
+	for range d.runners {
+		if c := <-exitCodes; c != 0 {
+			exitCode = c
+		}
+	}
+	stopServer(triggerServer)
+	stopServer(server)
+	d.Exiter(exitCode)
+}
@@ -0,0 +1,79 @@
+package reconcile
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDaemon(exitCode *int) *Daemon {
+	return &Daemon{
+		config:   &runnerConfig{},
+		registry: prometheus.NewRegistry(),
+		Exiter: func(i int) {
+			*exitCode = i
+		},
+	}
+}
+
+func runTestDaemon(t *testing.T, d *Daemon) {
+	finished := make(chan bool)
+	go func() {
+		d.Run()
+		finished <- true
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Daemon did not stop")
+	}
+}
+
+func TestNewIntegrationRunnerConfig(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.Set("sleepdurationsecs", 300)
+	viper.Set("integrations", map[string]interface{}{
+		"test": map[string]interface{}{
+			"dryrun":            false,
+			"sleepdurationsecs": 60,
+		},
+	})
+
+	config := newIntegrationRunnerConfig("test")
+	assert.False(t, config.DryRun)
+	assert.Equal(t, 60, config.SleepDurationSecs)
+	assert.Equal(t, 9090, config.PrometheusPort)
+
+	config = newIntegrationRunnerConfig("other")
+	assert.True(t, config.DryRun)
+	assert.Equal(t, 300, config.SleepDurationSecs)
+}
+
+func TestDaemonRunOnce(t *testing.T) {
+	exitCode := -1
+	d := newTestDaemon(&exitCode)
+	first := NewTestIntegration(throwErrorSettings{})
+	second := NewTestIntegration(throwErrorSettings{})
+	newTestRunner(t, first, withName("first"), withConfig(&runnerConfig{RunOnce: true}), withDaemon(d))
+	newTestRunner(t, second, withName("second"), withConfig(&runnerConfig{RunOnce: true}), withDaemon(d))
+
+	runTestDaemon(t, d)
+	assert.Equal(t, 0, exitCode)
+	assert.True(t, first.ReconcileRun)
+	assert.True(t, second.ReconcileRun)
+}
+
+func TestDaemonStopsOnFailure(t *testing.T) {
+	exitCode := -1
+	d := newTestDaemon(&exitCode)
+	failing := NewTestIntegration(throwErrorSettings{ThrowReconcileRunError: true})
+	healthy := NewTestIntegration(throwErrorSettings{})
+	newTestRunner(t, failing, withName("failing"), withConfig(&runnerConfig{SleepDurationSecs: 600, MaxConsecutiveFailures: 1}), withDaemon(d))
+	newTestRunner(t, healthy, withName("healthy"), withConfig(&runnerConfig{SleepDurationSecs: 600}), withDaemon(d))
+
+	runTestDaemon(t, d)
+	assert.Equal(t, 1, exitCode)
+}
@@ -0,0 +1,129 @@
+package reconcile
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// runHealth tracks the run loop of an IntegrationRunner for liveness and readiness probes
+type runHealth struct {
+	mu   sync.Mutex
+	name string
+	// stuckAfter is the maximum duration of a single run, 0 disables the check
+	stuckAfter time.Duration
+	// maxFailures is the number of consecutive failed runs considered unhealthy, 0 disables the check
+	maxFailures int
+
+	running             bool
+	runStarted          time.Time
+	consecutiveFailures int
+	shuttingDown        bool
+
+	now func() time.Time
+}
+
+func newRunHealth(name string, config *runnerConfig) *runHealth {
+	// Runs are expected to finish within Timeout, without a timeout we use the sleep interval as reference
+	reference := config.Timeout
+	if reference <= 0 {
+		reference = config.SleepDurationSecs
+	}
+	return &runHealth{
+		name:        name,
+		stuckAfter:  time.Duration(config.HealthStuckFactor*reference) * time.Second,
+		maxFailures: config.HealthMaxFailures,
+		now:         time.Now,
+	}
+}
+
+func (h *runHealth) start() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.running = true
+	h.runStarted = h.now()
+}
+
+func (h *runHealth) finish(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.running = false
+	if err != nil {
+		h.consecutiveFailures++
+	} else {
+		h.consecutiveFailures = 0
+	}
+}
+
+func (h *runHealth) shutdown() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.shuttingDown = true
+}
+
+// live returns an error if the run loop is stuck or keeps failing
+func (h *runHealth) live() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.stuckAfter > 0 && h.running {
+		if runningFor := h.now().Sub(h.runStarted); runningFor > h.stuckAfter {
+			return fmt.Errorf("run is stuck, running for %s, expected at most %s", runningFor.Round(time.Second), h.stuckAfter)
+		}
+	}
+	if h.maxFailures > 0 && h.consecutiveFailures >= h.maxFailures {
+		return fmt.Errorf("last %d runs failed", h.consecutiveFailures)
+	}
+	return nil
+}
+
+// ready returns an error if the runner is not live or is shutting down
+func (h *runHealth) ready() error {
+	if err := h.live(); err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.shuttingDown {
+		return fmt.Errorf("shutting down")
+	}
+	return nil
+}
+
+// healthGroup combines the health of multiple runners, it is unhealthy if any runner is
+type healthGroup []*runHealth
+
+func (g healthGroup) live() error {
+	for _, h := range g {
+		if err := h.live(); err != nil {
+			return fmt.Errorf("%s: %w", h.name, err)
+		}
+	}
+	return nil
+}
+
+func (g healthGroup) ready() error {
+	for _, h := range g {
+		if err := h.ready(); err != nil {
+			return fmt.Errorf("%s: %w", h.name, err)
+		}
+	}
+	return nil
+}
+
+func (g healthGroup) healthzHandler(w http.ResponseWriter, _ *http.Request) {
+	writeProbeResponse(w, g.live())
+}
+
+func (g healthGroup) readyzHandler(w http.ResponseWriter, _ *http.Request) {
+	writeProbeResponse(w, g.ready())
+}
+
+func writeProbeResponse(w http.ResponseWriter, err error) {
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, err.Error())
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
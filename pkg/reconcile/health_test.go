@@ -0,0 +1,65 @@
+package reconcile
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunHealthStuck(t *testing.T) {
+	now := time.Now()
+	h := newRunHealth("test", &runnerConfig{Timeout: 10, SleepDurationSecs: 600, HealthStuckFactor: 3})
+	h.now = func() time.Time { return now }
+	assert.Equal(t, 30*time.Second, h.stuckAfter)
+
+	h.start()
+	now = now.Add(29 * time.Second)
+	assert.NoError(t, h.live())
+
+	now = now.Add(2 * time.Second)
+	assert.ErrorContains(t, h.live(), "run is stuck")
+	assert.Error(t, h.ready())
+
+	h.finish(nil)
+	assert.NoError(t, h.live())
+}
+
+func TestRunHealthStuckWithoutTimeout(t *testing.T) {
+	h := newRunHealth("test", &runnerConfig{SleepDurationSecs: 600, HealthStuckFactor: 2})
+	assert.Equal(t, 20*time.Minute, h.stuckAfter)
+}
+
+func TestRunHealthFailures(t *testing.T) {
+	h := newRunHealth("test", &runnerConfig{HealthMaxFailures: 2})
+
+	h.finish(errors.New("failed"))
+	assert.NoError(t, h.live())
+	h.finish(errors.New("failed"))
+	assert.ErrorContains(t, h.live(), "last 2 runs failed")
+	h.finish(nil)
+	assert.NoError(t, h.live())
+}
+
+func TestRunHealthHandlers(t *testing.T) {
+	h := newRunHealth("test", &runnerConfig{})
+	g := healthGroup{newRunHealth("other", &runnerConfig{}), h}
+
+	rec := httptest.NewRecorder()
+	g.readyzHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	h.shutdown()
+
+	rec = httptest.NewRecorder()
+	g.readyzHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "test: shutting down\n", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	g.healthzHandler(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
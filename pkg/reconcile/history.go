@@ -0,0 +1,193 @@
+package reconcile
+
+import (
+	"context"
+	"time"
+
+	"github.com/app-sre/go-qontract-reconcile/pkg/util"
+)
+
+const (
+	// RunStatusSuccess is the status of a run without errors
+	RunStatusSuccess = "success"
+	// RunStatusFailure is the status of a failed run
+	RunStatusFailure = "failure"
+)
+
+// historyWriteAttempts is the number of times a run is added to the RunHistory, if it changed concurrently
+const historyWriteAttempts = 3
+
+// RunSummary is a compact record of a single run, only runs that reached Reconcile are recorded
+type RunSummary struct {
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Status    string    `json:"status"`
+	BundleSha string    `json:"bundleSha,omitempty"`
+	// Actions is the number of targets per action of the plan
+	Actions map[Action]int `json:"actions,omitempty"`
+	// PhaseErrors is the error of every failed phase
+	PhaseErrors map[string]string `json:"phaseErrors,omitempty"`
+	Error       string            `json:"error,omitempty"`
+
+	reconciled bool
+}
+
+// RunHistory holds the last runs of an integration, newest first
+type RunHistory struct {
+	Integration string       `json:"integration"`
+	Runs        []RunSummary `json:"runs"`
+}
+
+// HistoryStore persists RunHistory, it is implemented by state.Persistence.
+// Conditional writes must fail with an error that has a Conflict() bool method returning true, like state.ConflictError.
+type HistoryStore interface {
+	Exists(context.Context, string) (bool, error)
+	GetVersioned(context.Context, string, interface{}) (string, error)
+	AddIfVersion(context.Context, string, interface{}, string) (string, error)
+}
+
+type runSummaryKey struct{}
+
+// withRunSummary adds summary to ctx, so phases can record their outcome in it
+func withRunSummary(ctx context.Context, summary *RunSummary) context.Context {
+	return context.WithValue(ctx, runSummaryKey{}, summary)
+}
+
+// runSummaryFrom returns the RunSummary of ctx or nil
+func runSummaryFrom(ctx context.Context) *RunSummary {
+	summary, _ := ctx.Value(runSummaryKey{}).(*RunSummary)
+	return summary
+}
+
+// recordPhase records the error of a failed phase, it is safe to call on nil
+func (s *RunSummary) recordPhase(phase string, err error) {
+	if s == nil || err == nil {
+		return
+	}
+	if s.PhaseErrors == nil {
+		s.PhaseErrors = map[string]string{}
+	}
+	s.PhaseErrors[phase] = err.Error()
+}
+
+// setActions records the action counts of plan, it is safe to call on nil
+func (s *RunSummary) setActions(plan *Plan) {
+	if s == nil {
+		return
+	}
+	s.Actions = map[Action]int{}
+	for _, action := range []Action{ActionCreate, ActionUpdate, ActionDelete, ActionNoop} {
+		if count := plan.Count(action); count > 0 {
+			s.Actions[action] = count
+		}
+	}
+}
+
+// startReconcile marks that the run reached Reconcile, it is safe to call on nil
+func (s *RunSummary) startReconcile() {
+	if s == nil {
+		return
+	}
+	s.reconciled = true
+}
+
+// finish records the end and outcome of the run
+func (s *RunSummary) finish(end time.Time, err error) {
+	s.End = end
+	if err != nil {
+		s.Status = RunStatusFailure
+		s.Error = err.Error()
+	} else {
+		s.Status = RunStatusSuccess
+	}
+}
+
+// add prepends summary and keeps at most size runs
+func (h *RunHistory) add(summary RunSummary, size int) {
+	h.Runs = append([]RunSummary{summary}, h.Runs...)
+	if len(h.Runs) > size {
+		h.Runs = h.Runs[:size]
+	}
+}
+
+// readRunHistory reads the RunHistory stored under key and its version, it returns an empty RunHistory if there is none
+func readRunHistory(ctx context.Context, store HistoryStore, key string) (*RunHistory, string, error) {
+	history := &RunHistory{Integration: key}
+	exists, err := store.Exists(ctx, key)
+	if err != nil {
+		return nil, "", err
+	}
+	if !exists {
+		return history, "", nil
+	}
+	version, err := store.GetVersioned(ctx, key, history)
+	if err != nil {
+		return nil, "", err
+	}
+	return history, version, nil
+}
+
+// ReadRunHistory reads the RunHistory of the integration name, sharded integrations are read for the configured shard
+func ReadRunHistory(ctx context.Context, store HistoryStore, name string) (*RunHistory, error) {
+	history, _, err := readRunHistory(ctx, store, shardedName(name, newIntegrationRunnerConfig(name)))
+	return history, err
+}
+
+// newRunSummary creates the RunSummary for a run started at start
+func (i *IntegrationRunner) newRunSummary(ctx context.Context, start time.Time) *RunSummary {
+	summary := &RunSummary{Start: start}
+	// Dry runs never reach Reconcile and are not recorded
+	if !i.historyEnabled() || i.config.DryRun {
+		return summary
+	}
+	// The bundle trigger mode already knows the SHA of the bundle the run is based on
+	if i.trigger != nil && i.trigger.lastSha != "" {
+		summary.BundleSha = i.trigger.lastSha
+	} else if i.Bundle != nil {
+		sha, err := i.Bundle.BundleSha(ctx)
+		if err != nil {
+			util.Log().Warnw("Error while getting bundle sha", "integration", i.Name, "error", err.Error())
+		}
+		summary.BundleSha = sha
+	}
+	return summary
+}
+
+func (i *IntegrationRunner) historyEnabled() bool {
+	return i.config.RunHistory > 0 && i.NewHistoryStore != nil
+}
+
+// recordRun adds summary to the RunHistory if the run reached Reconcile, errors are logged and do not fail the run
+func (i *IntegrationRunner) recordRun(ctx context.Context, summary *RunSummary) {
+	if !i.historyEnabled() || !summary.reconciled {
+		return
+	}
+	if err := i.writeRunHistory(ctx, summary); err != nil {
+		util.Log().Warnw("Error while writing run history", "integration", i.Name, "error", err.Error())
+	}
+}
+
+func (i *IntegrationRunner) writeRunHistory(ctx context.Context, summary *RunSummary) error {
+	if i.history == nil {
+		store, err := i.NewHistoryStore(context.WithValue(ctx, ContextIngetrationNameKey, i.Name))
+		if err != nil {
+			return err
+		}
+		i.history = store
+	}
+	key := shardedName(i.Name, i.config)
+	var err error
+	for attempt := 0; attempt < historyWriteAttempts; attempt++ {
+		var history *RunHistory
+		var version string
+		history, version, err = readRunHistory(ctx, i.history, key)
+		if err != nil {
+			return err
+		}
+		history.add(*summary, i.config.RunHistory)
+		if _, err = i.history.AddIfVersion(ctx, key, history, version); !isConflict(err) {
+			return err
+		}
+	}
+	return err
+}
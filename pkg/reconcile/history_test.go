@@ -0,0 +1,143 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// withHistoryStore stores the run history in store, runs use a fixed bundle SHA
+func withHistoryStore(t *testing.T, store HistoryStore) testRunnerOption {
+	return withRunner(func(runner *IntegrationRunner) {
+		runner.Bundle = &fakeBundle{sha: "0123456789abcdef"}
+		runner.NewHistoryStore = func(ctx context.Context) (HistoryStore, error) {
+			assert.Equal(t, "test", ctx.Value(ContextIngetrationNameKey))
+			return store, nil
+		}
+	})
+}
+
+func TestLoopRecordsRunHistory(t *testing.T) {
+	store := newMemoryLeaseStore()
+	runner := newTestRunner(t, &TestPlanIntegration{}, withHistoryStore(t, store), withConfig(&runnerConfig{RunOnce: true, RunHistory: 5}))
+
+	assert.Equal(t, 0, runner.loop(context.Background()))
+
+	history, _, err := readRunHistory(context.Background(), store, "test")
+	assert.NoError(t, err)
+	assert.Len(t, history.Runs, 1)
+	run := history.Runs[0]
+	assert.Equal(t, RunStatusSuccess, run.Status)
+	assert.Equal(t, "0123456789abcdef", run.BundleSha)
+	assert.Equal(t, map[Action]int{ActionCreate: 1, ActionDelete: 1}, run.Actions)
+	assert.Empty(t, run.PhaseErrors)
+	assert.False(t, run.End.Before(run.Start))
+}
+
+func TestLoopRecordsFailedRun(t *testing.T) {
+	store := newMemoryLeaseStore()
+	integration := NewTestIntegration(throwErrorSettings{ThrowReconcileRunError: true})
+	runner := newTestRunner(t, integration, withHistoryStore(t, store), withConfig(&runnerConfig{RunOnce: true, RunHistory: 5}))
+
+	assert.Equal(t, 1, runner.loop(context.Background()))
+
+	history, _, err := readRunHistory(context.Background(), store, "test")
+	assert.NoError(t, err)
+	assert.Len(t, history.Runs, 1)
+	assert.Equal(t, RunStatusFailure, history.Runs[0].Status)
+	assert.Equal(t, "reconcile error", history.Runs[0].Error)
+	assert.Equal(t, map[string]string{phaseReconcile: "reconcile error"}, history.Runs[0].PhaseErrors)
+}
+
+func TestLoopSkipsRunsWithoutReconcile(t *testing.T) {
+	store := newMemoryLeaseStore()
+
+	// Dry runs
+	runner := newTestRunner(t, &TestIntegration{}, withHistoryStore(t, store), withConfig(&runnerConfig{RunOnce: true, DryRun: true, RunHistory: 5}))
+	assert.Equal(t, 0, runner.loop(context.Background()))
+
+	// Runs failing before Reconcile
+	integration := NewTestIntegration(throwErrorSettings{ThrowDesiredStateRunError: true})
+	runner = newTestRunner(t, integration, withHistoryStore(t, store), withConfig(&runnerConfig{RunOnce: true, RunHistory: 5}))
+	assert.Equal(t, 1, runner.loop(context.Background()))
+
+	// Standbys
+	now := time.Now()
+	leases := newMemoryLeaseStore()
+	newTestLeaderLock(leases, "holder", &now).renew(context.Background())
+	runner = newTestRunner(t, &TestIntegration{}, withHistoryStore(t, store), withConfig(&runnerConfig{RunHistory: 5}))
+	runner.leader = newTestLeaderLock(leases, "standby", &now)
+	summary := &RunSummary{Start: now}
+	assert.NoError(t, runner.runIntegration(withRunSummary(context.Background(), summary)))
+	summary.finish(now, nil)
+	runner.recordRun(context.Background(), summary)
+
+	exists, err := store.Exists(context.Background(), "test")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestRunHistoryRetriesConflicts(t *testing.T) {
+	store := newMemoryLeaseStore()
+	runner := newTestRunner(t, &TestIntegration{}, withHistoryStore(t, store), withConfig(&runnerConfig{RunHistory: 5}))
+	// Another run is recorded concurrently before the first write
+	store.beforeWrite = func(m *memoryLeaseStore, key string) {
+		m.beforeWrite = nil
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.put(key, RunHistory{Integration: key, Runs: []RunSummary{{Status: RunStatusFailure}}})
+	}
+	summary := &RunSummary{reconciled: true}
+	summary.finish(time.Now(), nil)
+	runner.recordRun(context.Background(), summary)
+
+	history, _, err := readRunHistory(context.Background(), store, "test")
+	assert.NoError(t, err)
+	assert.Len(t, history.Runs, 2)
+	assert.Equal(t, RunStatusSuccess, history.Runs[0].Status)
+	assert.Equal(t, RunStatusFailure, history.Runs[1].Status)
+}
+
+func TestRunHistoryKeepsLastRuns(t *testing.T) {
+	store := newMemoryLeaseStore()
+	runner := newTestRunner(t, &TestIntegration{}, withHistoryStore(t, store), withConfig(&runnerConfig{RunHistory: 2, Shards: 2, ShardID: 1}))
+	start := time.Now()
+	for n := 0; n < 3; n++ {
+		summary := &RunSummary{Start: start.Add(time.Duration(n) * time.Minute), reconciled: true}
+		summary.finish(summary.Start, nil)
+		runner.recordRun(context.Background(), summary)
+	}
+
+	history, _, err := readRunHistory(context.Background(), store, "test-shard-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "test-shard-1", history.Integration)
+	assert.Len(t, history.Runs, 2)
+	assert.Equal(t, start.Add(2*time.Minute).Unix(), history.Runs[0].Start.Unix())
+	assert.Equal(t, start.Add(time.Minute).Unix(), history.Runs[1].Start.Unix())
+}
+
+func TestRunHistoryDisabled(t *testing.T) {
+	store := newMemoryLeaseStore()
+	runner := newTestRunner(t, &TestIntegration{}, withHistoryStore(t, store), withConfig(&runnerConfig{RunOnce: true}))
+
+	assert.Equal(t, 0, runner.loop(context.Background()))
+	assert.Empty(t, store.objects)
+}
+
+func TestRunHistoryStoreError(t *testing.T) {
+	runner := newTestRunner(t, &TestIntegration{}, withHistoryStore(t, nil), withConfig(&runnerConfig{RunOnce: true, RunHistory: 5}))
+	runner.NewHistoryStore = func(context.Context) (HistoryStore, error) {
+		return nil, errors.New("no bucket")
+	}
+
+	assert.Equal(t, 0, runner.loop(context.Background()))
+}
+
+func TestRunSummaryOutsideOfRun(t *testing.T) {
+	// Recording outside of a run is a no-op
+	runSummaryFrom(context.Background()).recordPhase(phaseSetup, errors.New("failed"))
+	runSummaryFrom(context.Background()).startReconcile()
+}
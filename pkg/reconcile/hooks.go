@@ -0,0 +1,75 @@
+package reconcile
+
+import (
+	"context"
+
+	"github.com/app-sre/go-qontract-reconcile/pkg/util"
+)
+
+const (
+	phasePostReconcile = "post_reconcile"
+	phaseTeardown      = "teardown"
+)
+
+// Teardowner can be implemented by Integrations to release clients or clean up working directories.
+// Teardown runs after every run that called Setup, even if a later phase failed.
+type Teardowner interface {
+	Teardown(ctx context.Context) error
+}
+
+// PostReconciler can be implemented by Integrations to act on the outcome of Reconcile, err is the error Reconcile returned
+type PostReconciler interface {
+	PostReconcile(ctx context.Context, ri *ResourceInventory, err error) error
+}
+
+// PlanValidator can be implemented by Integrations to veto unsafe plans. Validate runs after planning,
+// an error fails the run before Reconcile. It runs on dry runs too, so vetoes show up before merging.
+type PlanValidator interface {
+	Validate(ctx context.Context, ri *ResourceInventory) error
+}
+
+// validatePlan runs Validate of a PlanValidator
+func (i *IntegrationRunner) validatePlan(ctx context.Context, phases *phaseMetrics, ri *ResourceInventory) error {
+	validator, ok := i.Runnable.(PlanValidator)
+	if !ok {
+		return nil
+	}
+	return runPhase(ctx, phases, phaseValidate, func(ctx context.Context) error { return validator.Validate(ctx, ri) })
+}
+
+// postReconcile runs PostReconcile of a PostReconciler, it returns reconcileErr if set and the error of PostReconcile otherwise
+func (i *IntegrationRunner) postReconcile(ctx context.Context, phases *phaseMetrics, ri *ResourceInventory, reconcileErr error) error {
+	postReconciler, ok := i.Runnable.(PostReconciler)
+	if !ok {
+		return reconcileErr
+	}
+	err := runPhase(ctx, phases, phasePostReconcile, func(ctx context.Context) error {
+		return postReconciler.PostReconcile(ctx, ri, reconcileErr)
+	})
+	if err == nil {
+		return reconcileErr
+	}
+	util.Log().Errorw("Error during PostReconcile", "error", err.Error())
+	if reconcileErr != nil {
+		return reconcileErr
+	}
+	return err
+}
+
+// teardown runs Teardown of a Teardowner, it returns runErr if set and the error of Teardown otherwise.
+// Teardown gets a context, that is not canceled with ctx, so it can clean up after timeouts.
+func (i *IntegrationRunner) teardown(ctx context.Context, phases *phaseMetrics, runErr error) error {
+	teardowner, ok := i.Runnable.(Teardowner)
+	if !ok {
+		return runErr
+	}
+	err := runPhase(context.WithoutCancel(ctx), phases, phaseTeardown, teardowner.Teardown)
+	if err == nil {
+		return runErr
+	}
+	util.Log().Errorw("Error during Teardown", "error", err.Error())
+	if runErr != nil {
+		return runErr
+	}
+	return err
+}
@@ -0,0 +1,132 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// hookIntegration records the hooks called by the runner
+type hookIntegration struct {
+	TestIntegration
+	hooks         []string
+	validateErr   error
+	postErr       error
+	teardownErr   error
+	reconcileErr  error
+	postGotErr    error
+	teardownCtxOK bool
+}
+
+func (h *hookIntegration) Reconcile(context.Context, *ResourceInventory) error {
+	h.hooks = append(h.hooks, "reconcile")
+	return h.reconcileErr
+}
+
+func (h *hookIntegration) Validate(context.Context, *ResourceInventory) error {
+	h.hooks = append(h.hooks, "validate")
+	return h.validateErr
+}
+
+func (h *hookIntegration) PostReconcile(_ context.Context, _ *ResourceInventory, err error) error {
+	h.hooks = append(h.hooks, "post_reconcile")
+	h.postGotErr = err
+	return h.postErr
+}
+
+func (h *hookIntegration) Teardown(ctx context.Context) error {
+	h.hooks = append(h.hooks, "teardown")
+	h.teardownCtxOK = ctx.Err() == nil
+	return h.teardownErr
+}
+
+var _ Teardowner = &hookIntegration{}
+var _ PostReconciler = &hookIntegration{}
+var _ PlanValidator = &hookIntegration{}
+
+func TestRunIntegrationHooks(t *testing.T) {
+	integration := &hookIntegration{}
+	runner := newTestRunner(t, integration)
+	err := runner.runIntegration(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"validate", "reconcile", "post_reconcile", "teardown"}, integration.hooks)
+	assert.Equal(t, 1.0, testutil.ToFloat64(runner.metrics.phases.runs.WithLabelValues(phaseTeardown)))
+}
+
+func TestRunIntegrationHooksDryRun(t *testing.T) {
+	integration := &hookIntegration{}
+	err := newTestRunner(t, integration, withConfig(&runnerConfig{DryRun: true})).runIntegration(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"validate", "teardown"}, integration.hooks)
+}
+
+func TestRunIntegrationValidateVeto(t *testing.T) {
+	integration := &hookIntegration{validateErr: errors.New("unsafe plan")}
+	err := newTestRunner(t, integration).runIntegration(context.Background())
+	assert.EqualError(t, err, "unsafe plan")
+	assert.Equal(t, []string{"validate", "teardown"}, integration.hooks)
+}
+
+func TestRunIntegrationPostReconcileErrors(t *testing.T) {
+	integration := &hookIntegration{postErr: errors.New("post failed")}
+	err := newTestRunner(t, integration).runIntegration(context.Background())
+	assert.EqualError(t, err, "post failed")
+
+	integration = &hookIntegration{reconcileErr: errors.New("reconcile failed"), postErr: errors.New("post failed")}
+	err = newTestRunner(t, integration).runIntegration(context.Background())
+	assert.EqualError(t, err, "reconcile failed")
+	assert.EqualError(t, integration.postGotErr, "reconcile failed")
+	assert.Equal(t, []string{"validate", "reconcile", "post_reconcile", "teardown"}, integration.hooks)
+}
+
+func TestRunIntegrationTeardown(t *testing.T) {
+	integration := &hookIntegration{teardownErr: errors.New("teardown failed")}
+	err := newTestRunner(t, integration).runIntegration(context.Background())
+	assert.EqualError(t, err, "teardown failed")
+
+	integration = &hookIntegration{reconcileErr: errors.New("reconcile failed"), teardownErr: errors.New("teardown failed")}
+	err = newTestRunner(t, integration).runIntegration(context.Background())
+	assert.EqualError(t, err, "reconcile failed")
+}
+
+func TestRunIntegrationTeardownAfterFailedSetup(t *testing.T) {
+	integration := &hookIntegration{TestIntegration: TestIntegration{errorSettings: throwErrorSettings{ThrowSetUpRunError: true}}}
+	err := newTestRunner(t, integration).runIntegration(context.Background())
+	assert.EqualError(t, err, "setup error")
+	assert.Equal(t, []string{"teardown"}, integration.hooks)
+}
+
+func TestRunIntegrationTeardownAfterTimeout(t *testing.T) {
+	integration := &hookIntegration{}
+	runner := newTestRunner(t, integration)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NoError(t, runner.runIntegration(ctx))
+	assert.True(t, integration.teardownCtxOK)
+}
+
+// typedHookIntegration vetoes every plan
+type typedHookIntegration struct {
+	TestTypedIntegration
+	tornDown bool
+}
+
+func (h *typedHookIntegration) Validate(_ context.Context, ri *TypedResourceInventory[*testConfig, int, int]) error {
+	return errors.New("veto " + ri.GetResourceState("a").Config.Name)
+}
+
+func (h *typedHookIntegration) Teardown(context.Context) error {
+	h.tornDown = true
+	return nil
+}
+
+func TestRunTypedIntegrationHooks(t *testing.T) {
+	integration := &typedHookIntegration{}
+	err := newTestRunner(t, AdaptTypedIntegration[*testConfig, int, int](integration)).runIntegration(context.Background())
+	assert.EqualError(t, err, "veto a")
+	assert.Empty(t, integration.Reconciled)
+	assert.True(t, integration.tornDown)
+}
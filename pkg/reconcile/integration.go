@@ -2,15 +2,17 @@ package reconcile
 
 import (
 	"context"
-	"fmt"
-	"net/http"
+	"errors"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/app-sre/go-qontract-reconcile/pkg/tracing"
 	"github.com/app-sre/go-qontract-reconcile/pkg/util"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type integrationNameKey string
@@ -60,8 +62,18 @@ type ResourceState struct {
 }
 
 type integrationRunnerMetrics struct {
-	status prometheus.Gauge
-	time   prometheus.Gauge
+	status        prometheus.Gauge
+	time          prometheus.Gauge
+	disabled      prometheus.Gauge
+	actions       *prometheus.GaugeVec
+	failedTargets prometheus.Gauge
+	triggers      *prometheus.CounterVec
+	deletions     prometheus.Gauge
+	deletionAbort prometheus.Counter
+	failures      prometheus.Gauge
+	backoff       prometheus.Gauge
+	leader        prometheus.Gauge
+	phases        *phaseMetrics
 }
 
 func newIntegrationRunnerMetrics(reg prometheus.Registerer, integration string) *integrationRunnerMetrics {
@@ -78,12 +90,132 @@ func newIntegrationRunnerMetrics(reg prometheus.Registerer, integration string)
 			Help:        "Last run duration in seconds",
 			ConstLabels: labels,
 		}),
+		disabled: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "qontract_reconcile_integration_disabled",
+			Help:        "Set to 1 if the last run was skipped due to a disabled feature toggle",
+			ConstLabels: labels,
+		}),
+		actions: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name:        "qontract_reconcile_planned_actions",
+			Help:        "Number of targets per action planned in the last run",
+			ConstLabels: labels,
+		}, []string{"action"}),
+		failedTargets: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "qontract_reconcile_failed_targets",
+			Help:        "Number of targets that failed during the last Reconcile",
+			ConstLabels: labels,
+		}),
+		triggers: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "qontract_reconcile_run_triggers_total",
+			Help:        "Number of runs started per trigger reason",
+			ConstLabels: labels,
+		}, []string{"reason"}),
+		deletions: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "qontract_reconcile_planned_deletions",
+			Help:        "Number of deletions planned in the last run",
+			ConstLabels: labels,
+		}),
+		deletionAbort: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "qontract_reconcile_deletion_limit_aborts_total",
+			Help:        "Number of runs aborted because planned deletions exceeded the limit",
+			ConstLabels: labels,
+		}),
+		failures: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "qontract_reconcile_consecutive_failures",
+			Help:        "Number of consecutive failed runs",
+			ConstLabels: labels,
+		}),
+		backoff: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "qontract_reconcile_backoff_seconds",
+			Help:        "Delay before the next run after a failed run, 0 if the last run succeeded",
+			ConstLabels: labels,
+		}),
+		leader: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "qontract_reconcile_leader",
+			Help:        "Set to 1 if this replica holds the leader lease or leader election is disabled",
+			ConstLabels: labels,
+		}),
+		phases: newPhaseMetrics(reg, labels),
 	}
 	reg.MustRegister(m.status)
 	reg.MustRegister(m.time)
+	reg.MustRegister(m.disabled)
+	reg.MustRegister(m.actions)
+	reg.MustRegister(m.failedTargets)
+	reg.MustRegister(m.triggers)
+	reg.MustRegister(m.deletions)
+	reg.MustRegister(m.deletionAbort)
+	reg.MustRegister(m.failures)
+	reg.MustRegister(m.backoff)
+	reg.MustRegister(m.leader)
 	return m
 }
 
+func (m *integrationRunnerMetrics) phaseMetrics() *phaseMetrics {
+	if m == nil {
+		return nil
+	}
+	return m.phases
+}
+
+// setFailedTargets sets the number of failed targets, if err is a TargetErrors
+func (m *integrationRunnerMetrics) setFailedTargets(err error) {
+	if m == nil {
+		return
+	}
+	var targetErrors *TargetErrors
+	if errors.As(err, &targetErrors) {
+		m.failedTargets.Set(float64(len(targetErrors.Errors)))
+	} else {
+		m.failedTargets.Set(0)
+	}
+}
+
+func (m *integrationRunnerMetrics) setActions(plan *Plan) {
+	if m == nil {
+		return
+	}
+	for _, action := range []Action{ActionCreate, ActionUpdate, ActionDelete, ActionNoop} {
+		m.actions.WithLabelValues(string(action)).Set(float64(plan.Count(action)))
+	}
+}
+
+func (m *integrationRunnerMetrics) countTrigger(reason string) {
+	if m == nil {
+		return
+	}
+	m.triggers.WithLabelValues(reason).Inc()
+}
+
+func (m *integrationRunnerMetrics) setPlannedDeletions(deletions int) {
+	if m == nil {
+		return
+	}
+	m.deletions.Set(float64(deletions))
+}
+
+func (m *integrationRunnerMetrics) countDeletionAbort() {
+	if m == nil {
+		return
+	}
+	m.deletionAbort.Inc()
+}
+
+func (m *integrationRunnerMetrics) setBackoff(failures int, delay time.Duration) {
+	if m == nil {
+		return
+	}
+	m.failures.Set(float64(failures))
+	m.backoff.Set(delay.Seconds())
+}
+
+func (m *integrationRunnerMetrics) setLeader(leader bool) {
+	if m == nil {
+		return
+	}
+	m.leader.Set(boolToFloat(leader))
+}
+
 // IntegrationRunner is an implementation of Runner
 type IntegrationRunner struct {
 	Runnable Integration
@@ -92,12 +224,28 @@ type IntegrationRunner struct {
 	Exiter   exitFunc
 	metrics  *integrationRunnerMetrics
 	registry *prometheus.Registry
+	health   *runHealth
+	trigger  *trigger
+	leader   *leaderLock
+	// Bundle is required for the bundle trigger mode
+	Bundle BundleShaGetter
+	// NewLeaseStore is required for leader election, ctx contains the integration name
+	NewLeaseStore func(ctx context.Context) (LeaseStore, error)
+	// NewHistoryStore is required for the run history, ctx contains the integration name
+	NewHistoryStore func(ctx context.Context) (HistoryStore, error)
+	history         HistoryStore
+	// skipSetup skips Setup and Teardown, it is set by RunOnce
+	skipSetup bool
+	// inspect is called with the ResourceInventory and the Plan after every run, it is set by RunOnce
+	inspect func(*ResourceInventory, *Plan)
 }
 
 // NewIntegrationRunner creates a IntegrationRunner for a given Integration
 func NewIntegrationRunner(runnable Integration, name string) *IntegrationRunner {
-	c := newRunnerConfig()
-	registry := prometheus.NewRegistry()
+	return newIntegrationRunner(runnable, name, newRunnerConfig(), prometheus.NewRegistry())
+}
+
+func newIntegrationRunner(runnable Integration, name string, c *runnerConfig, registry *prometheus.Registry) *IntegrationRunner {
 	v := &IntegrationRunner{
 		Runnable: runnable,
 		Name:     name,
@@ -110,13 +258,15 @@ func NewIntegrationRunner(runnable Integration, name string) *IntegrationRunner
 			v.metrics.status.Set(float64(exitCode))
 		}
 		util.Log().Debugw("Exiting", "exitCode", exitCode)
+		tracing.Shutdown(context.Background())
 		os.Exit(exitCode)
 	}
 	return v
 }
 
-func (i *IntegrationRunner) runIntegration() {
-	ctx := context.WithValue(context.Background(), ContextIngetrationNameKey, i.Name)
+// runIntegration runs all phases of the integration once, it stops at the first failing phase
+func (i *IntegrationRunner) runIntegration(ctx context.Context) (err error) {
+	ctx = context.WithValue(ctx, ContextIngetrationNameKey, i.Name)
 	var cancel func()
 	if i.config.Timeout > 0 {
 		ctx, cancel = context.WithTimeout(ctx, time.Duration(i.config.Timeout)*time.Second)
@@ -124,57 +274,244 @@ func (i *IntegrationRunner) runIntegration() {
 		ctx, cancel = context.WithCancel(ctx)
 	}
 	defer cancel()
+	ctx, span := tracing.Start(ctx, "run", attribute.String("integration", i.Name), attribute.Bool("dry_run", i.config.DryRun))
+	defer func() { tracing.End(span, err) }()
+
+	if i.config.UseFeatureToggle {
+		enabled, err := isFeatureEnabled(ctx, i.Name)
+		if err != nil {
+			util.Log().Errorw("Error while checking feature toggle", "error", err.Error())
+			return err
+		}
+		if i.metrics != nil {
+			i.metrics.disabled.Set(boolToFloat(!enabled))
+		}
+		if !enabled {
+			util.Log().Warnw("Integration not enabled, skipping run")
+			return nil
+		}
+	}
 
 	ri := NewResourceInventory()
+	var plan *Plan
+	if i.inspect != nil {
+		defer func() { i.inspect(ri, plan) }()
+	}
+	phases := i.metrics.phaseMetrics()
 
-	err := i.Runnable.Setup(ctx)
-	if err != nil {
-		util.Log().Errorw("Error during setup", "error", err.Error())
-		i.Exiter(1)
+	if !i.skipSetup {
+		defer func() { err = i.teardown(ctx, phases, err) }()
+		err = runPhase(ctx, phases, phaseSetup, i.Runnable.Setup)
+		if err != nil {
+			util.Log().Errorw("Error during setup", "error", err.Error())
+			return err
+		}
 	}
 
-	err = i.Runnable.CurrentState(ctx, ri)
+	err = runPhase(ctx, phases, phaseCurrentState, func(ctx context.Context) error { return i.Runnable.CurrentState(ctx, ri) })
 	if err != nil {
 		util.Log().Errorw("Error during CurrentState", "error", err.Error())
-		i.Exiter(1)
+		return err
 	}
-	err = i.Runnable.DesiredState(ctx, ri)
+	err = runPhase(ctx, phases, phaseDesiredState, func(ctx context.Context) error { return i.Runnable.DesiredState(ctx, ri) })
 	if err != nil {
 		util.Log().Errorw("Error during DesiredState", "error", err.Error())
-		i.Exiter(1)
+		return err
+	}
+	err = recoverPhase(ctx, phases, phaseShard, func() error { return i.filterShard(ri) })
+	runSummaryFrom(ctx).recordPhase(phaseShard, err)
+	if err != nil {
+		util.Log().Errorw("Error while filtering shard", "error", err.Error())
+		return err
+	}
+	err = recoverPhase(ctx, phases, phasePlan, func() error {
+		i.Runnable.LogDiff(ri)
+		plan = i.plan(ri)
+		return nil
+	})
+	runSummaryFrom(ctx).recordPhase(phasePlan, err)
+	if err != nil {
+		util.Log().Errorw("Error during Plan", "error", err.Error())
+		return err
+	}
+	i.metrics.setActions(plan)
+	runSummaryFrom(ctx).setActions(plan)
+	leader := i.isLeader()
+	i.metrics.setLeader(leader)
+	if !i.config.DryRun && !leader {
+		util.Log().Infow("Not the leader, skipping Reconcile")
+		return nil
+	}
+	deletions, err := i.plannedDeletions(ctx, phases, ri, plan)
+	if err != nil {
+		util.Log().Errorw("Error during PlannedDeletions", "error", err.Error())
+		return err
+	}
+	if err := i.checkDeletionLimit(ri, deletions); err != nil {
+		if !i.config.DryRun {
+			util.Log().Errorw("Aborting run", "error", err.Error())
+			runSummaryFrom(ctx).recordPhase(phaseDeletionLimit, err)
+			i.metrics.countDeletionAbort()
+			return err
+		}
+		util.Log().Warnw("Run would be aborted", "error", err.Error())
+	}
+	if err := i.validatePlan(ctx, phases, ri); err != nil {
+		util.Log().Errorw("Error during Validate", "error", err.Error())
+		return err
 	}
-	i.Runnable.LogDiff(ri)
 	if !i.config.DryRun {
-		err = i.Runnable.Reconcile(ctx, ri)
+		// Targets are not reconciled anymore once another replica might have taken over
+		reconcileCtx, stopReconcile := i.leaderContext(ctx)
+		runSummaryFrom(ctx).startReconcile()
+		err = runPhase(reconcileCtx, phases, phaseReconcile, func(ctx context.Context) error { return i.Runnable.Reconcile(ctx, ri) })
+		stopReconcile()
+		i.metrics.setFailedTargets(err)
 		if err != nil {
 			util.Log().Errorw("Error during Reconcile", "error", err.Error())
-			i.Exiter(1)
+		}
+		if err = i.postReconcile(ctx, phases, ri, err); err != nil {
+			return err
 		}
 	} else {
 		util.Log().Debugw("DryRun is enabled, not running Reconcile")
+		if err := i.writePlan(plan); err != nil {
+			util.Log().Errorw("Error while writing plan", "error", err.Error())
+			return err
+		}
 	}
-	if i.metrics != nil {
-		i.metrics.status.Set(float64(0))
+	return nil
+}
+
+// plan returns the Plan for the ResourceInventory
+func (i *IntegrationRunner) plan(ri *ResourceInventory) *Plan {
+	return PlanFor(i.Name, i.Runnable, ri)
+}
+
+// writePlan writes the plan to the configured output
+func (i *IntegrationRunner) writePlan(plan *Plan) error {
+	if i.config.PlanOutput == "" {
+		return nil
+	}
+	return plan.WriteFile(i.config.PlanOutput)
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
 	}
+	return 0
 }
 
-// Run runs the integration
+// Run runs the integration until it receives SIGINT or SIGTERM
 func (i *IntegrationRunner) Run() {
-	go func(i *IntegrationRunner) {
-		http.Handle("/metrics", promhttp.HandlerFor(i.registry, promhttp.HandlerOpts{Registry: i.registry}))
-		util.Log().Fatal(http.ListenAndServe(fmt.Sprintf(":%d", i.config.PrometheusPort), nil))
-	}(i)
+	signalCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	for {
+	if err := i.setupLoop(); err != nil {
+		util.Log().Errorw("Error while setting up runner", "integration", i.Name, "error", err.Error())
+		i.Exiter(1)
+		return
+	}
+	server := startServer(i.config.PrometheusPort, i.registry, healthGroup{i.health})
+	triggerServer := startTriggerServer(i.config.TriggerAddress, i)
+	exitCode := i.loop(signalCtx)
+	stopServer(triggerServer)
+	stopServer(server)
+	i.Exiter(exitCode)
+}
+
+// setupLoop prepares health and trigger used by loop
+func (i *IntegrationRunner) setupLoop() error {
+	t, err := newTrigger(i.config, i.Bundle)
+	if err != nil {
+		return err
+	}
+	i.trigger = t
+	i.health = newRunHealth(i.Name, i.config)
+	return nil
+}
+
+// loop runs the integration until signalCtx is done, it returns the exit code for the process
+func (i *IntegrationRunner) loop(signalCtx context.Context) int {
+	ctx, cancel := withGracePeriod(signalCtx, time.Duration(i.config.ShutdownGracePeriodSecs)*time.Second)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-signalCtx.Done():
+			i.health.shutdown()
+		case <-ctx.Done():
+		}
+	}()
+
+	stopLeaderElection, err := i.startLeaderElection(ctx)
+	if err != nil {
+		util.Log().Errorw("Error while starting leader election", "integration", i.Name, "error", err.Error())
+		return 1
+	}
+	defer stopLeaderElection()
+
+	failures := 0
+	for signalCtx.Err() == nil {
+		i.trigger.beforeRun(ctx)
 		start := time.Now()
-		i.runIntegration()
+		summary := i.newRunSummary(ctx, start)
+		i.health.start()
+		err := i.runIntegration(withRunSummary(ctx, summary))
+		i.health.finish(err)
 		end := time.Now()
 		i.metrics.time.Set(end.Sub(start).Seconds())
+		summary.finish(end, err)
+		i.recordRun(ctx, summary)
+		if err != nil {
+			exitCode := exitCodeFor(err)
+			i.metrics.status.Set(float64(exitCode))
+			failures++
+			// Retrying does not help against exceeded deletion limits, they require an override
+			if i.config.RunOnce || exitCode == exitCodeDeletionLimit || (i.config.MaxConsecutiveFailures > 0 && failures >= i.config.MaxConsecutiveFailures) {
+				i.metrics.setBackoff(failures, 0)
+				return exitCode
+			}
+			delay := util.Backoff(failures, time.Duration(i.config.BackoffSecs)*time.Second, time.Duration(i.config.MaxBackoffSecs)*time.Second)
+			i.metrics.setBackoff(failures, delay)
+			util.Log().Warnw("Run failed, backing off", "integration", i.Name, "failures", failures, "delay", delay.String())
+			if reason := i.trigger.waitBackoff(signalCtx, delay); reason != "" {
+				i.metrics.countTrigger(reason)
+			}
+			continue
+		}
+		failures = 0
+		i.metrics.setBackoff(0, 0)
+		i.metrics.status.Set(float64(0))
 		if i.config.RunOnce {
-			i.Exiter(0)
-		} else {
-			util.Log().Debugw("Sleeping", "seconds", i.config.SleepDurationSecs)
-			time.Sleep(time.Duration(i.config.SleepDurationSecs) * time.Second)
+			break
+		}
+		util.Log().Debugw("Waiting for next run", "integration", i.Name, "mode", i.trigger.mode)
+		if reason := i.trigger.wait(signalCtx); reason != "" {
+			util.Log().Debugw("Run triggered", "integration", i.Name, "reason", reason)
+			i.metrics.countTrigger(reason)
 		}
 	}
+	return 0
+}
+
+// withGracePeriod returns a context, that is canceled gracePeriod after ctx is done
+func withGracePeriod(ctx context.Context, gracePeriod time.Duration) (context.Context, context.CancelFunc) {
+	graceCtx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-ctx.Done():
+			util.Log().Infow("Received shutdown signal, waiting for current run to finish", "gracePeriod", gracePeriod.String())
+		case <-graceCtx.Done():
+			return
+		}
+		select {
+		case <-time.After(gracePeriod):
+			util.Log().Warnw("Grace period exceeded, canceling current run")
+			cancel()
+		case <-graceCtx.Done():
+		}
+	}()
+	return graceCtx, cancel
 }
@@ -3,8 +3,16 @@ package reconcile
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/app-sre/go-qontract-reconcile/pkg/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -66,6 +74,56 @@ func (e *TestIntegration) Setup(context.Context) error {
 	return nil
 }
 
+// testRunner holds the settings of a runner created by newTestRunner
+type testRunner struct {
+	name     string
+	config   *runnerConfig
+	registry *prometheus.Registry
+	daemon   *Daemon
+	setup    []func(*IntegrationRunner)
+}
+
+// testRunnerOption changes the runner created by newTestRunner
+type testRunnerOption func(*testRunner)
+
+func withName(name string) testRunnerOption {
+	return func(r *testRunner) { r.name = name }
+}
+
+func withConfig(config *runnerConfig) testRunnerOption {
+	return func(r *testRunner) { r.config = config }
+}
+
+// withDaemon adds the runner to d and registers its metrics in the registry of d
+func withDaemon(d *Daemon) testRunnerOption {
+	return func(r *testRunner) { r.daemon = d }
+}
+
+// withRunner changes the runner after it was created, i.e. to set stores
+func withRunner(f func(*IntegrationRunner)) testRunnerOption {
+	return func(r *testRunner) { r.setup = append(r.setup, f) }
+}
+
+// newTestRunner creates a runner named test with an empty config and its own registry, ready to run loop
+func newTestRunner(t *testing.T, runnable Integration, opts ...testRunnerOption) *IntegrationRunner {
+	r := &testRunner{name: "test", config: &runnerConfig{}, registry: prometheus.NewRegistry()}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.daemon != nil {
+		r.registry = r.daemon.registry
+	}
+	runner := newIntegrationRunner(runnable, r.name, r.config, r.registry)
+	for _, f := range r.setup {
+		f(runner)
+	}
+	assert.NoError(t, runner.setupLoop())
+	if r.daemon != nil {
+		r.daemon.runners = append(r.daemon.runners, runner)
+	}
+	return runner
+}
+
 func TestRunIntegrationErrors(t *testing.T) {
 	type testCase struct {
 		name          string
@@ -82,20 +140,17 @@ func TestRunIntegrationErrors(t *testing.T) {
 	}
 
 	for _, testCase := range testCases {
-		exitCalled := false
 		runner := IntegrationRunner{
 			Runnable: NewTestIntegration(testCase.errorSettings),
 			config: &runnerConfig{
 				Timeout: 10,
 			},
-			Exiter: func(exitCode int) {
-				exitCalled = true
-			},
 		}
-		runner.runIntegration()
+		err := runner.runIntegration(context.Background())
 		if testCase.shouldFail {
-			assert.True(t, exitCalled)
+			assert.Error(t, err)
 		} else {
+			assert.NoError(t, err)
 			assert.True(t, runner.Runnable.(*TestIntegration).CurrentStateRun)
 			assert.True(t, runner.Runnable.(*TestIntegration).DesiredStateRun)
 			assert.True(t, runner.Runnable.(*TestIntegration).ReconcileRun)
@@ -104,3 +159,101 @@ func TestRunIntegrationErrors(t *testing.T) {
 		}
 	}
 }
+
+func TestRunIntegrationFeatureToggle(t *testing.T) {
+	type testCase struct {
+		name    string
+		enabled bool
+	}
+
+	testCases := []testCase{
+		{name: "feature disabled", enabled: false},
+		{name: "feature enabled", enabled: true},
+	}
+
+	for _, testCase := range testCases {
+		unleashMock := util.NewHTTPTestServer(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/client/features/test", r.URL.Path)
+			fmt.Fprintf(w, `{"enabled":%t,"name":"test","project":"default","type":"release"}`, testCase.enabled)
+		})
+		os.Setenv("UNLEASH_API_URL", unleashMock.URL)
+
+		runner := IntegrationRunner{
+			Runnable: NewTestIntegration(throwErrorSettings{}),
+			Name:     "test",
+			config: &runnerConfig{
+				UseFeatureToggle: true,
+			},
+			metrics: newIntegrationRunnerMetrics(prometheus.NewRegistry(), "test"),
+		}
+		err := runner.runIntegration(context.Background())
+		unleashMock.Close()
+
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.enabled, runner.Runnable.(*TestIntegration).SetUpRun)
+		assert.Equal(t, testCase.enabled, runner.Runnable.(*TestIntegration).ReconcileRun)
+		assert.Equal(t, boolToFloat(!testCase.enabled), testutil.ToFloat64(runner.metrics.disabled))
+	}
+	os.Unsetenv("UNLEASH_API_URL")
+}
+
+type TestSignalIntegration struct {
+	TestIntegration
+	ReconcileCtxErr error
+}
+
+func (e *TestSignalIntegration) Reconcile(ctx context.Context, _ *ResourceInventory) error {
+	syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	time.Sleep(100 * time.Millisecond)
+	e.ReconcileCtxErr = ctx.Err()
+	e.ReconcileRun = true
+	return nil
+}
+
+func TestRunGracefulShutdown(t *testing.T) {
+	exitCode := -1
+	integration := &TestSignalIntegration{}
+	runner := IntegrationRunner{
+		Runnable: integration,
+		Name:     "test",
+		config: &runnerConfig{
+			SleepDurationSecs:       600,
+			ShutdownGracePeriodSecs: 10,
+		},
+		registry: prometheus.NewRegistry(),
+		metrics:  newIntegrationRunnerMetrics(prometheus.NewRegistry(), "test"),
+		Exiter: func(i int) {
+			exitCode = i
+		},
+	}
+
+	finished := make(chan bool)
+	go func() {
+		runner.Run()
+		finished <- true
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after SIGTERM")
+	}
+	assert.Equal(t, 0, exitCode)
+	assert.True(t, integration.ReconcileRun)
+	assert.NoError(t, integration.ReconcileCtxErr)
+}
+
+func TestWithGracePeriod(t *testing.T) {
+	parent, cancelParent := context.WithCancel(context.Background())
+	ctx, cancel := withGracePeriod(parent, 50*time.Millisecond)
+	defer cancel()
+
+	cancelParent()
+	assert.NoError(t, ctx.Err())
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("context not canceled after grace period")
+	}
+}
@@ -0,0 +1,266 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/app-sre/go-qontract-reconcile/pkg/util"
+)
+
+// errLeaseLost is the cause of cancelled Reconcile contexts, if the leader lease was lost during a run
+var errLeaseLost = errors.New("lost leader lease")
+
+// LeaseStore persists leader election leases, it is implemented by state.Persistence.
+// Conditional writes must fail with an error that has a Conflict() bool method returning true, like state.ConflictError.
+type LeaseStore interface {
+	Exists(context.Context, string) (bool, error)
+	GetVersioned(context.Context, string, interface{}) (string, error)
+	AddIfVersion(context.Context, string, interface{}, string) (string, error)
+	RmIfVersion(context.Context, string, string) error
+}
+
+// isConflict checks if err is a conditional write that failed because the key changed, i.e. a state.ConflictError
+func isConflict(err error) bool {
+	var conflict interface{ Conflict() bool }
+	return errors.As(err, &conflict) && conflict.Conflict()
+}
+
+// lease is the object stored by the current leader
+type lease struct {
+	Holder    string    `json:"holder"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// leaderLock grants leadership to a single replica by holding a lease in a LeaseStore.
+// The lease is renewed regularly, if the leader dies a standby takes over once the lease expired.
+// Leases are written with AddIfVersion, so only one of several replicas taking an expired lease succeeds.
+type leaderLock struct {
+	store         LeaseStore
+	key           string
+	identity      string
+	leaseDuration time.Duration
+	renewInterval time.Duration
+	now           func() time.Time
+
+	mu      sync.Mutex
+	expires time.Time
+	// version of the lease written by this replica
+	version string
+	// lost is closed once the held lease is lost
+	lost chan struct{}
+}
+
+func newLeaderLock(store LeaseStore, key string, config *runnerConfig) (*leaderLock, error) {
+	identity, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	if config.LeaseRenewSecs <= 0 || config.LeaseRenewSecs >= config.LeaseDurationSecs {
+		return nil, fmt.Errorf("lease renew interval must be greater than 0 and less than the lease duration")
+	}
+	return &leaderLock{
+		store:         store,
+		key:           key,
+		identity:      identity,
+		leaseDuration: time.Duration(config.LeaseDurationSecs) * time.Second,
+		renewInterval: time.Duration(config.LeaseRenewSecs) * time.Second,
+		now:           time.Now,
+	}, nil
+}
+
+// isLeader returns true while this replica holds an unexpired lease
+func (l *leaderLock) isLeader() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.now().Before(l.expires)
+}
+
+// hold records the lease written with version, that is valid until expires
+func (l *leaderLock) hold(expires time.Time, version string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.lost == nil {
+		l.lost = make(chan struct{})
+	}
+	l.expires = expires
+	l.version = version
+}
+
+// resign forgets the held lease and cancels the contexts returned by leaderContext
+func (l *leaderLock) resign() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.expires = time.Time{}
+	l.version = ""
+	if l.lost != nil {
+		close(l.lost)
+		l.lost = nil
+	}
+}
+
+// tryAcquire takes the lease if it is free or expired and renews it if it is held already
+func (l *leaderLock) tryAcquire(ctx context.Context) (bool, error) {
+	version := ""
+	exists, err := l.store.Exists(ctx, l.key)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		var current lease
+		version, err = l.store.GetVersioned(ctx, l.key, &current)
+		if err != nil {
+			return false, err
+		}
+		if current.Holder != l.identity && l.now().Before(current.ExpiresAt) {
+			return false, nil
+		}
+	}
+
+	acquired := l.now()
+	written, err := l.store.AddIfVersion(ctx, l.key, lease{Holder: l.identity, ExpiresAt: acquired.Add(l.leaseDuration)}, version)
+	if isConflict(err) {
+		// Another replica wrote the lease since it was read
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	l.hold(acquired.Add(l.leaseDuration), written)
+	return true, nil
+}
+
+// renew tries to acquire or renew the lease and logs leadership changes
+func (l *leaderLock) renew(ctx context.Context) {
+	wasLeader := l.isLeader()
+	leader, err := l.tryAcquire(ctx)
+	if err != nil {
+		util.Log().Errorw("Error while renewing leader lease", "key", l.key, "error", err.Error())
+		// The lease is kept until it expires
+		leader = l.isLeader()
+	}
+	if !leader {
+		l.resign()
+	}
+	switch {
+	case leader && !wasLeader:
+		util.Log().Infow("Acquired leader lease", "key", l.key, "identity", l.identity)
+	case !leader && wasLeader:
+		util.Log().Warnw("Lost leader lease", "key", l.key, "identity", l.identity)
+	}
+}
+
+// leaderContext returns a context, that is cancelled with errLeaseLost once this replica loses or fails to renew the lease
+func (l *leaderLock) leaderContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	go func() {
+		for {
+			l.mu.Lock()
+			lost, remaining := l.lost, l.expires.Sub(l.now())
+			l.mu.Unlock()
+			if lost == nil || remaining <= 0 {
+				cancel(errLeaseLost)
+				return
+			}
+			// The lease is checked again at its expiry, as renewals extend it
+			select {
+			case <-ctx.Done():
+				return
+			case <-lost:
+				cancel(errLeaseLost)
+				return
+			case <-time.After(remaining):
+			}
+		}
+	}()
+	return ctx, func() { cancel(context.Canceled) }
+}
+
+// keepAlive renews the lease every renewInterval until ctx is done, then releases it
+func (l *leaderLock) keepAlive(ctx context.Context) {
+	ticker := time.NewTicker(l.renewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			l.release()
+			return
+		case <-ticker.C:
+			l.renew(ctx)
+		}
+	}
+}
+
+// release deletes the lease if this replica holds it, so a standby does not have to wait for it to expire
+func (l *leaderLock) release() {
+	if !l.isLeader() {
+		return
+	}
+	l.mu.Lock()
+	version := l.version
+	l.mu.Unlock()
+	l.resign()
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.renewInterval)
+	defer cancel()
+	if err := l.store.RmIfVersion(ctx, l.key, version); err != nil {
+		if isConflict(err) {
+			util.Log().Warnw("Leader lease was taken over before it was released", "key", l.key, "identity", l.identity)
+			return
+		}
+		util.Log().Errorw("Error while releasing leader lease", "key", l.key, "error", err.Error())
+		return
+	}
+	util.Log().Infow("Released leader lease", "key", l.key, "identity", l.identity)
+}
+
+// startLeaderElection acquires the lease once and keeps renewing it in the background. The returned
+// function stops renewing and releases the lease.
+func (i *IntegrationRunner) startLeaderElection(ctx context.Context) (func(), error) {
+	if !i.config.LeaderElection {
+		return func() {}, nil
+	}
+	if i.NewLeaseStore == nil {
+		return nil, fmt.Errorf("leader election requires a LeaseStore")
+	}
+	ctx, cancel := context.WithCancel(context.WithValue(ctx, ContextIngetrationNameKey, i.Name))
+	store, err := i.NewLeaseStore(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// Every shard elects its own leader
+	lock, err := newLeaderLock(store, shardedName(i.Name, i.config), i.config)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	i.leader = lock
+	lock.renew(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		lock.keepAlive(ctx)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}, nil
+}
+
+// isLeader returns true if leader election is disabled or this replica holds the lease
+func (i *IntegrationRunner) isLeader() bool {
+	return i.leader == nil || i.leader.isLeader()
+}
+
+// leaderContext returns a context for Reconcile, that is cancelled if this replica loses the lease
+func (i *IntegrationRunner) leaderContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if i.leader == nil {
+		return context.WithCancel(ctx)
+	}
+	return i.leader.leaderContext(ctx)
+}
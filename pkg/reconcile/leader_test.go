@@ -0,0 +1,261 @@
+package reconcile
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryConflictError is returned by failed conditional writes of memoryLeaseStore
+type memoryConflictError struct {
+	key string
+}
+
+func (e *memoryConflictError) Error() string {
+	return fmt.Sprintf("key %s changed concurrently", e.key)
+}
+
+func (e *memoryConflictError) Conflict() bool {
+	return true
+}
+
+// memoryLeaseStore is a LeaseStore and HistoryStore keeping JSON encoded values in memory, versions are a generation counter
+type memoryLeaseStore struct {
+	mu         sync.Mutex
+	objects    map[string][]byte
+	versions   map[string]string
+	generation int
+	// beforeWrite is called before every conditional write, it can be used to simulate concurrent writers
+	beforeWrite func(*memoryLeaseStore, string)
+}
+
+func newMemoryLeaseStore() *memoryLeaseStore {
+	return &memoryLeaseStore{objects: map[string][]byte{}, versions: map[string]string{}}
+}
+
+func (m *memoryLeaseStore) Exists(_ context.Context, key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.objects[key]
+	return ok, nil
+}
+
+// put stores value under key with a new version, m.mu must be held
+func (m *memoryLeaseStore) put(key string, value interface{}) (string, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	m.generation++
+	m.objects[key] = b
+	m.versions[key] = fmt.Sprintf("%d", m.generation)
+	return m.versions[key], nil
+}
+
+func (m *memoryLeaseStore) AddIfVersion(_ context.Context, key string, value interface{}, version string) (string, error) {
+	if m.beforeWrite != nil {
+		m.beforeWrite(m, key)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.versions[key] != version {
+		return "", &memoryConflictError{key: key}
+	}
+	return m.put(key, value)
+}
+
+func (m *memoryLeaseStore) RmIfVersion(_ context.Context, key string, version string) error {
+	if m.beforeWrite != nil {
+		m.beforeWrite(m, key)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.versions[key] != version {
+		return &memoryConflictError{key: key}
+	}
+	delete(m.objects, key)
+	delete(m.versions, key)
+	return nil
+}
+
+func (m *memoryLeaseStore) Get(ctx context.Context, key string, value interface{}) error {
+	_, err := m.GetVersioned(ctx, key, value)
+	return err
+}
+
+func (m *memoryLeaseStore) GetVersioned(_ context.Context, key string, value interface{}) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.objects[key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found", key)
+	}
+	return m.versions[key], json.Unmarshal(b, value)
+}
+
+func newTestLeaderLock(store LeaseStore, identity string, now *time.Time) *leaderLock {
+	return &leaderLock{
+		store:         store,
+		key:           "test",
+		identity:      identity,
+		leaseDuration: time.Minute,
+		renewInterval: 20 * time.Second,
+		now:           func() time.Time { return *now },
+	}
+}
+
+func TestLeaderLockAcquire(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	store := newMemoryLeaseStore()
+	first := newTestLeaderLock(store, "first", &now)
+	second := newTestLeaderLock(store, "second", &now)
+
+	first.renew(ctx)
+	second.renew(ctx)
+	assert.True(t, first.isLeader())
+	assert.False(t, second.isLeader())
+
+	// Renewing extends the lease
+	now = now.Add(50 * time.Second)
+	first.renew(ctx)
+	second.renew(ctx)
+	assert.True(t, first.isLeader())
+	assert.False(t, second.isLeader())
+
+	// The standby takes over once the lease expired
+	now = now.Add(2 * time.Minute)
+	assert.False(t, first.isLeader())
+	second.renew(ctx)
+	assert.True(t, second.isLeader())
+	first.renew(ctx)
+	assert.False(t, first.isLeader())
+}
+
+func TestLeaderLockRelease(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	store := newMemoryLeaseStore()
+	first := newTestLeaderLock(store, "first", &now)
+	second := newTestLeaderLock(store, "second", &now)
+
+	first.renew(ctx)
+	first.release()
+	assert.False(t, first.isLeader())
+
+	second.renew(ctx)
+	assert.True(t, second.isLeader())
+
+	// A lease taken over is not deleted
+	now = now.Add(2 * time.Minute)
+	first.renew(ctx)
+	assert.True(t, first.isLeader())
+	second.release()
+	exists, err := store.Exists(ctx, "test")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestLeaderLockConcurrentWriter(t *testing.T) {
+	now := time.Now()
+	store := newMemoryLeaseStore()
+	store.beforeWrite = func(m *memoryLeaseStore, key string) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.put(key, lease{Holder: "other", ExpiresAt: now.Add(time.Minute)})
+	}
+	lock := newTestLeaderLock(store, "first", &now)
+
+	leader, err := lock.tryAcquire(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, leader)
+
+	var current lease
+	assert.NoError(t, store.Get(context.Background(), "test", &current))
+	assert.Equal(t, "other", current.Holder)
+}
+
+func TestLeaderContextCancelledOnLostLease(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	store := newMemoryLeaseStore()
+	first := newTestLeaderLock(store, "first", &now)
+	second := newTestLeaderLock(store, "second", &now)
+	first.renew(ctx)
+
+	leaderCtx, cancel := first.leaderContext(ctx)
+	defer cancel()
+	assert.NoError(t, leaderCtx.Err())
+
+	// The lease expires and is taken over by the standby
+	now = now.Add(2 * time.Minute)
+	second.renew(ctx)
+	first.renew(ctx)
+
+	<-leaderCtx.Done()
+	assert.ErrorIs(t, context.Cause(leaderCtx), errLeaseLost)
+
+	// Standbys never get a running context
+	standbyCtx, cancel := first.leaderContext(ctx)
+	defer cancel()
+	<-standbyCtx.Done()
+	assert.ErrorIs(t, context.Cause(standbyCtx), errLeaseLost)
+}
+
+func TestStandbySkipsReconcile(t *testing.T) {
+	now := time.Now()
+	store := newMemoryLeaseStore()
+	holder := newTestLeaderLock(store, "holder", &now)
+	holder.renew(context.Background())
+
+	integration := NewTestIntegration(throwErrorSettings{})
+	runner := newTestRunner(t, integration)
+	runner.leader = newTestLeaderLock(store, "standby", &now)
+	runner.leader.renew(context.Background())
+
+	assert.NoError(t, runner.runIntegration(context.Background()))
+	assert.True(t, integration.DesiredStateRun)
+	assert.False(t, integration.ReconcileRun)
+	assert.Equal(t, 0.0, testutil.ToFloat64(runner.metrics.leader))
+}
+
+// leaseLosingIntegration loses the leader lease to another replica during Reconcile
+type leaseLosingIntegration struct {
+	TestIntegration
+	takeOver func()
+}
+
+func (e *leaseLosingIntegration) Reconcile(ctx context.Context, ri *ResourceInventory) error {
+	e.takeOver()
+	return ForEachTarget(ctx, map[string]*ResourceState{"target": {}}, func(ctx context.Context, _ string, _ *ResourceState) error {
+		<-ctx.Done()
+		return context.Cause(ctx)
+	})
+}
+
+func TestReconcileStopsOnLostLease(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	store := newMemoryLeaseStore()
+	other := newTestLeaderLock(store, "other", &now)
+
+	integration := &leaseLosingIntegration{}
+	runner := newTestRunner(t, integration)
+	runner.leader = newTestLeaderLock(store, "leader", &now)
+	runner.leader.renew(ctx)
+	integration.takeOver = func() {
+		now = now.Add(2 * time.Minute)
+		other.renew(ctx)
+		runner.leader.renew(ctx)
+	}
+
+	err := runner.runIntegration(ctx)
+	assert.ErrorContains(t, err, errLeaseLost.Error())
+	assert.True(t, other.isLeader())
+}
@@ -0,0 +1,88 @@
+package reconcile
+
+import (
+	"context"
+	"time"
+
+	"github.com/app-sre/go-qontract-reconcile/pkg/tracing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	phaseSetup        = "setup"
+	phaseCurrentState = "current_state"
+	phaseDesiredState = "desired_state"
+	phaseReconcile    = "reconcile"
+	phaseValidate     = "validate"
+)
+
+// phaseMetrics are shared by IntegrationRunner and ValidationRunner to instrument single phases of a run
+type phaseMetrics struct {
+	duration *prometheus.HistogramVec
+	runs     *prometheus.CounterVec
+	failures *prometheus.CounterVec
+	panics   *prometheus.CounterVec
+}
+
+func newPhaseMetrics(reg prometheus.Registerer, labels prometheus.Labels) *phaseMetrics {
+	m := &phaseMetrics{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "qontract_reconcile_phase_duration_seconds",
+			Help:        "Duration of a single phase of a run in seconds",
+			ConstLabels: labels,
+			Buckets:     prometheus.ExponentialBuckets(0.1, 2, 14),
+		}, []string{"phase"}),
+		runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "qontract_reconcile_phase_runs_total",
+			Help:        "Number of times a phase was run",
+			ConstLabels: labels,
+		}, []string{"phase"}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "qontract_reconcile_phase_failures_total",
+			Help:        "Number of times a phase failed",
+			ConstLabels: labels,
+		}, []string{"phase"}),
+		panics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "qontract_reconcile_panics_total",
+			Help:        "Number of panics recovered per phase",
+			ConstLabels: labels,
+		}, []string{"phase"}),
+	}
+	reg.MustRegister(m.duration)
+	reg.MustRegister(m.runs)
+	reg.MustRegister(m.failures)
+	reg.MustRegister(m.panics)
+	return m
+}
+
+// observe records duration and outcome of phase, it is safe to call on nil
+func (m *phaseMetrics) observe(phase string, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	m.duration.WithLabelValues(phase).Observe(time.Since(start).Seconds())
+	m.runs.WithLabelValues(phase).Inc()
+	if err != nil {
+		m.failures.WithLabelValues(phase).Inc()
+	}
+}
+
+// countPanic counts a recovered panic in phase, it is safe to call on nil
+func (m *phaseMetrics) countPanic(phase string) {
+	if m == nil {
+		return
+	}
+	m.panics.WithLabelValues(phase).Inc()
+}
+
+// runPhase runs f in a span named after phase and records it as phase in m, a panic in f is returned as error
+func runPhase(ctx context.Context, m *phaseMetrics, phase string, f func(ctx context.Context) error) error {
+	ctx, span := tracing.Start(ctx, phase)
+	start := time.Now()
+	err := recoverPhase(ctx, m, phase, func() error { return f(ctx) })
+	m.observe(phase, start, err)
+	runSummaryFrom(ctx).recordPhase(phase, err)
+	tracing.End(span, err)
+	return err
+}
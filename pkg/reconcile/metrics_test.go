@@ -0,0 +1,103 @@
+package reconcile
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestIntegrationRunnerPhaseMetrics(t *testing.T) {
+	runner := IntegrationRunner{
+		Runnable: NewTestIntegration(throwErrorSettings{ThrowDesiredStateRunError: true}),
+		Name:     "test",
+		config:   &runnerConfig{},
+		metrics:  newIntegrationRunnerMetrics(prometheus.NewRegistry(), "test"),
+	}
+	err := runner.runIntegration(context.Background())
+	assert.Error(t, err)
+
+	phases := runner.metrics.phases
+	assert.Equal(t, float64(1), testutil.ToFloat64(phases.runs.WithLabelValues(phaseSetup)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(phases.runs.WithLabelValues(phaseDesiredState)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(phases.runs.WithLabelValues(phaseReconcile)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(phases.failures.WithLabelValues(phaseCurrentState)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(phases.failures.WithLabelValues(phaseDesiredState)))
+	assert.Equal(t, 3, testutil.CollectAndCount(phases.duration))
+}
+
+func TestIntegrationRunnerPhaseSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(provider)
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+
+	runner := IntegrationRunner{
+		Runnable: NewTestIntegration(throwErrorSettings{ThrowDesiredStateRunError: true}),
+		Name:     "test",
+		config:   &runnerConfig{},
+	}
+	err := runner.runIntegration(context.Background())
+	assert.Error(t, err)
+
+	spans := exporter.GetSpans()
+	names := []string{}
+	for _, s := range spans {
+		names = append(names, s.Name)
+	}
+	assert.Equal(t, []string{phaseSetup, phaseCurrentState, phaseDesiredState, "run"}, names)
+	run := spans[len(spans)-1]
+	for _, s := range spans[:len(spans)-1] {
+		assert.Equal(t, run.SpanContext.SpanID(), s.Parent.SpanID())
+	}
+	assert.Equal(t, codes.Error, spans[2].Status.Code)
+	assert.Equal(t, codes.Error, run.Status.Code)
+}
+
+func TestIntegrationRunnerActionMetrics(t *testing.T) {
+	runner := IntegrationRunner{
+		Runnable: &TestPlanIntegration{},
+		Name:     "test",
+		config:   &runnerConfig{},
+		metrics:  newIntegrationRunnerMetrics(prometheus.NewRegistry(), "test"),
+	}
+	err := runner.runIntegration(context.Background())
+	assert.NoError(t, err)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(runner.metrics.actions.WithLabelValues(string(ActionCreate))))
+	assert.Equal(t, float64(1), testutil.ToFloat64(runner.metrics.actions.WithLabelValues(string(ActionDelete))))
+	assert.Equal(t, float64(0), testutil.ToFloat64(runner.metrics.actions.WithLabelValues(string(ActionUpdate))))
+}
+
+func TestDerivePlan(t *testing.T) {
+	ri := NewResourceInventory()
+	ri.AddResourceState("create", &ResourceState{Desired: "a"})
+	ri.AddResourceState("delete", &ResourceState{Current: "a"})
+	ri.AddResourceState("update", &ResourceState{Current: "a", Desired: "b"})
+	ri.AddResourceState("noop", &ResourceState{Current: "a", Desired: "a"})
+
+	plan := NewPlan("test")
+	derivePlan(ri, plan)
+	for _, action := range []Action{ActionCreate, ActionDelete, ActionUpdate, ActionNoop} {
+		assert.Equal(t, 1, plan.Count(action))
+	}
+}
+
+func TestValidationRunnerMetrics(t *testing.T) {
+	tv := TestValidation{
+		ReturnValidations: true,
+	}
+	vr := NewValidationRunner(&tv, "test")
+	vr.Exiter = func(i int) {}
+	vr.Run()
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(vr.metrics.validationErrors.WithLabelValues("test", string(SeverityError))))
+	assert.Equal(t, float64(1), testutil.ToFloat64(vr.metrics.phases.runs.WithLabelValues(phaseValidate)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(vr.metrics.phases.failures.WithLabelValues(phaseValidate)))
+}
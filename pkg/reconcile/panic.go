@@ -0,0 +1,48 @@
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/app-sre/go-qontract-reconcile/pkg/util"
+)
+
+// Phases only recovered from panics, they are not instrumented like the other phases
+const (
+	// phasePlan covers LogDiff and Plan of an Integration
+	phasePlan = "plan"
+	// phaseShard covers ShardKey of a ShardKeyer
+	phaseShard = "shard"
+	// phaseDeletionLimit covers PlannedDeletions of a DeletionCounter
+	phaseDeletionLimit = "deletion_limit"
+)
+
+// panicError is returned for a phase that panicked
+type panicError struct {
+	Phase string
+	Value interface{}
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("panic during %s: %v", e.Phase, e.Value)
+}
+
+// recoverPhase runs f and turns a panic into a panicError, logging the stack and counting it in m
+func recoverPhase(ctx context.Context, m *phaseMetrics, phase string, f func() error) (err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		name, _ := ctx.Value(ContextIngetrationNameKey).(string)
+		util.Log().Errorw("Recovered from panic",
+			"integration", name,
+			"phase", phase,
+			"panic", fmt.Sprint(r),
+			"stack", string(debug.Stack()))
+		m.countPanic(phase)
+		err = &panicError{Phase: phase, Value: r}
+	}()
+	return f()
+}
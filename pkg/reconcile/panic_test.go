@@ -0,0 +1,121 @@
+package reconcile
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// panickingIntegration panics in DesiredState like a failed type assertion would
+type panickingIntegration struct {
+	TestIntegration
+}
+
+func (p *panickingIntegration) DesiredState(context.Context, *ResourceInventory) error {
+	var data map[string]interface{}
+	_ = data["user_name"].(string)
+	return nil
+}
+
+// panickingDiffIntegration panics in LogDiff
+type panickingDiffIntegration struct {
+	TestIntegration
+}
+
+func (p *panickingDiffIntegration) LogDiff(*ResourceInventory) {
+	panic("diff failed")
+}
+
+// panickingCounterIntegration panics in PlannedDeletions and ShardKey
+type panickingCounterIntegration struct {
+	TestIntegration
+}
+
+func (p *panickingCounterIntegration) DesiredState(_ context.Context, ri *ResourceInventory) error {
+	ri.AddResourceState("target", &ResourceState{Desired: "desired"})
+	return nil
+}
+
+func (p *panickingCounterIntegration) PlannedDeletions(*ResourceInventory, *Plan) int {
+	panic("count failed")
+}
+
+func (p *panickingCounterIntegration) ShardKey(string, *ResourceState) string {
+	panic("shard key failed")
+}
+
+// panickingValidation panics in Validate
+type panickingValidation struct {
+	TestValidation
+}
+
+func (p *panickingValidation) Validate(context.Context) ([]ValidationError, error) {
+	panic("validate failed")
+}
+
+func TestRunIntegrationRecoversPanic(t *testing.T) {
+	runner := newTestRunner(t, &panickingIntegration{})
+
+	err := runner.runIntegration(context.Background())
+	var panicErr *panicError
+	assert.ErrorAs(t, err, &panicErr)
+	assert.Equal(t, phaseDesiredState, panicErr.Phase)
+	assert.ErrorContains(t, err, "panic during desired_state: interface conversion")
+
+	phases := runner.metrics.phases
+	assert.Equal(t, 1.0, testutil.ToFloat64(phases.panics.WithLabelValues(phaseDesiredState)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(phases.failures.WithLabelValues(phaseDesiredState)))
+	assert.Equal(t, 0.0, testutil.ToFloat64(phases.runs.WithLabelValues(phaseReconcile)))
+}
+
+func TestRunIntegrationRecoversPanicInLogDiff(t *testing.T) {
+	integration := &panickingDiffIntegration{}
+	runner := newTestRunner(t, integration)
+
+	err := runner.runIntegration(context.Background())
+	assert.EqualError(t, err, "panic during plan: diff failed")
+	assert.Equal(t, 1.0, testutil.ToFloat64(runner.metrics.phases.panics.WithLabelValues(phasePlan)))
+	assert.False(t, integration.ReconcileRun)
+}
+
+func TestRunIntegrationRecoversPanicInPlannedDeletions(t *testing.T) {
+	integration := &panickingCounterIntegration{}
+	// Dry runs fail as well, they only warn about exceeded deletion limits
+	runner := newTestRunner(t, integration, withConfig(&runnerConfig{DryRun: true}))
+
+	err := runner.runIntegration(context.Background())
+	assert.EqualError(t, err, "panic during deletion_limit: count failed")
+	assert.Equal(t, 1.0, testutil.ToFloat64(runner.metrics.phases.panics.WithLabelValues(phaseDeletionLimit)))
+}
+
+func TestRunIntegrationRecoversPanicInShardKey(t *testing.T) {
+	integration := &panickingCounterIntegration{}
+	runner := newTestRunner(t, integration, withConfig(&runnerConfig{Shards: 2, ShardStrategy: ShardStrategyKey}))
+	ctx := withRunSummary(context.Background(), &RunSummary{})
+
+	err := runner.runIntegration(ctx)
+	assert.EqualError(t, err, "panic during shard: shard key failed")
+	assert.Equal(t, 1.0, testutil.ToFloat64(runner.metrics.phases.panics.WithLabelValues(phaseShard)))
+	assert.Equal(t, map[string]string{phaseShard: err.Error()}, runSummaryFrom(ctx).PhaseErrors)
+	assert.False(t, integration.ReconcileRun)
+}
+
+func TestLoopTreatsPanicAsFailure(t *testing.T) {
+	runner := newTestRunner(t, &panickingIntegration{}, withMaxFailures(1))
+
+	assert.Equal(t, 1, runner.loop(context.Background()))
+	assert.Equal(t, 1.0, testutil.ToFloat64(runner.metrics.failures))
+}
+
+func TestValidationRunnerRecoversPanic(t *testing.T) {
+	vr := NewValidationRunner(&panickingValidation{}, "test")
+	var exitCode int
+	vr.Exiter = func(i int) {
+		exitCode = i
+	}
+	vr.Run()
+	assert.Equal(t, 1, exitCode)
+	assert.Equal(t, 1.0, testutil.ToFloat64(vr.metrics.phases.panics.WithLabelValues(phaseValidate)))
+}
@@ -0,0 +1,125 @@
+package reconcile
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+)
+
+// Action describes what Reconcile is going to do with a target
+type Action string
+
+const (
+	// ActionCreate is used for targets, that do not exist yet
+	ActionCreate Action = "create"
+	// ActionUpdate is used for targets, that exist but differ from the desired state
+	ActionUpdate Action = "update"
+	// ActionDelete is used for targets, that exist but are not desired anymore
+	ActionDelete Action = "delete"
+	// ActionNoop is used for targets, that are already in the desired state
+	ActionNoop Action = "noop"
+)
+
+// Planner can be implemented by Integrations to export a machine-readable plan
+type Planner interface {
+	// Plan adds an entry for every target in the ResourceInventory to the Plan
+	Plan(*ResourceInventory, *Plan)
+}
+
+// PlanEntry describes the action for a single ResourceInventory target
+type PlanEntry struct {
+	Target string `json:"target"`
+	Action Action `json:"action"`
+	// Before is a short summary of the current state
+	Before string `json:"before,omitempty"`
+	// After is a short summary of the desired state
+	After string `json:"after,omitempty"`
+}
+
+// Plan describes the actions Reconcile takes for a given ResourceInventory
+type Plan struct {
+	Integration string      `json:"integration"`
+	Entries     []PlanEntry `json:"entries"`
+}
+
+// NewPlan creates an empty Plan for the given integration
+func NewPlan(integration string) *Plan {
+	return &Plan{
+		Integration: integration,
+		Entries:     []PlanEntry{},
+	}
+}
+
+// Add adds a PlanEntry for target to the Plan
+func (p *Plan) Add(target string, action Action, before, after string) {
+	p.Entries = append(p.Entries, PlanEntry{
+		Target: target,
+		Action: action,
+		Before: before,
+		After:  after,
+	})
+}
+
+// Count returns the number of entries with the given action
+func (p *Plan) Count(action Action) int {
+	count := 0
+	for _, e := range p.Entries {
+		if e.Action == action {
+			count++
+		}
+	}
+	return count
+}
+
+// Write writes the Plan as JSON, entries are sorted by target to allow diffing plans
+func (p *Plan) Write(w io.Writer) error {
+	sort.SliceStable(p.Entries, func(i, j int) bool {
+		return p.Entries[i].Target < p.Entries[j].Target
+	})
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(p)
+}
+
+// PlanFor returns the Plan of runnable for the ResourceInventory, it is derived from the inventory if runnable is no Planner
+func PlanFor(name string, runnable Integration, ri *ResourceInventory) *Plan {
+	plan := NewPlan(name)
+	if planner, ok := runnable.(Planner); ok {
+		planner.Plan(ri, plan)
+	} else {
+		derivePlan(ri, plan)
+	}
+	return plan
+}
+
+// derivePlan adds an entry for every target based on which states are set,
+// it is used for Integrations, that do not implement Planner
+func derivePlan(ri *ResourceInventory, plan *Plan) {
+	for target, rs := range ri.State {
+		switch {
+		case rs.Current == nil && rs.Desired != nil:
+			plan.Add(target, ActionCreate, "", "")
+		case rs.Current != nil && rs.Desired == nil:
+			plan.Add(target, ActionDelete, "", "")
+		case reflect.DeepEqual(rs.Current, rs.Desired):
+			plan.Add(target, ActionNoop, "", "")
+		default:
+			plan.Add(target, ActionUpdate, "", "")
+		}
+	}
+}
+
+// WriteFile writes the Plan to path, "-" writes to stdout
+func (p *Plan) WriteFile(path string) error {
+	if path == "-" {
+		return p.Write(os.Stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return p.Write(f)
+}
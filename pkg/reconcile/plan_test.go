@@ -0,0 +1,69 @@
+package reconcile
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type TestPlanIntegration struct {
+	TestIntegration
+}
+
+func (e *TestPlanIntegration) Plan(_ *ResourceInventory, plan *Plan) {
+	plan.Add("b", ActionDelete, "old", "")
+	plan.Add("a", ActionCreate, "", "new")
+}
+
+var _ Planner = &TestPlanIntegration{}
+
+func TestPlanWrite(t *testing.T) {
+	plan := NewPlan("test")
+	plan.Add("b", ActionUpdate, "1", "2")
+	plan.Add("a", ActionNoop, "1", "1")
+
+	var buf bytes.Buffer
+	err := plan.Write(&buf)
+	assert.NoError(t, err)
+
+	var written Plan
+	err = json.Unmarshal(buf.Bytes(), &written)
+	assert.NoError(t, err)
+	assert.Equal(t, "test", written.Integration)
+	assert.Len(t, written.Entries, 2)
+	assert.Equal(t, "a", written.Entries[0].Target)
+	assert.Equal(t, ActionUpdate, written.Entries[1].Action)
+	assert.Equal(t, 1, plan.Count(ActionNoop))
+	assert.Equal(t, 0, plan.Count(ActionDelete))
+}
+
+func TestRunIntegrationWritesPlan(t *testing.T) {
+	planPath := filepath.Join(t.TempDir(), "plan.json")
+	runner := IntegrationRunner{
+		Runnable: &TestPlanIntegration{},
+		Name:     "test",
+		config: &runnerConfig{
+			DryRun:     true,
+			PlanOutput: planPath,
+		},
+	}
+	err := runner.runIntegration(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, runner.Runnable.(*TestPlanIntegration).ReconcileRun)
+
+	content, err := os.ReadFile(planPath)
+	assert.NoError(t, err)
+
+	var written Plan
+	err = json.Unmarshal(content, &written)
+	assert.NoError(t, err)
+	assert.Equal(t, []PlanEntry{
+		{Target: "a", Action: ActionCreate, After: "new"},
+		{Target: "b", Action: ActionDelete, Before: "old"},
+	}, written.Entries)
+}
@@ -19,12 +19,36 @@ type Runner interface {
 
 // RunnerConfig is used to unmarshal yaml configuration Runners
 type runnerConfig struct {
-	Timeout           int
-	UseFeatureToggle  bool
-	DryRun            bool
-	RunOnce           bool
-	SleepDurationSecs int
-	PrometheusPort    int
+	Timeout                 int
+	UseFeatureToggle        bool
+	DryRun                  bool
+	RunOnce                 bool
+	SleepDurationSecs       int
+	PrometheusPort          int
+	PlanOutput              string
+	ShutdownGracePeriodSecs int
+	HealthStuckFactor       int
+	HealthMaxFailures       int
+	Shards                  int
+	ShardID                 int
+	ShardStrategy           string
+	ValidationReports       []string
+	ValidationBaseline      string
+	TriggerMode             string
+	BundlePollSecs          int
+	MaxIdleSecs             int
+	TriggerAddress          string
+	MaxDeletions            int
+	MaxDeletionsPercent     int
+	AllowDeletions          bool
+	MaxConsecutiveFailures  int
+	BackoffSecs             int
+	MaxBackoffSecs          int
+	LeaderElection          bool
+	LeaseDurationSecs       int
+	LeaseRenewSecs          int
+	RunHistory              int
+	PushGateway             string
 }
 
 // newRunnerConfig creates a new IntegationConfig from viper, v can be nil
@@ -37,6 +61,30 @@ func newRunnerConfig() *runnerConfig {
 	v.SetDefault("runonce", false)
 	v.SetDefault("sleepdurationsecs", 600)
 	v.SetDefault("prometheusport", 9090)
+	v.SetDefault("planoutput", "")
+	v.SetDefault("shutdowngraceperiodsecs", 25)
+	v.SetDefault("healthstuckfactor", 3)
+	v.SetDefault("healthmaxfailures", 3)
+	v.SetDefault("shards", 1)
+	v.SetDefault("shardid", 0)
+	v.SetDefault("shardstrategy", ShardStrategyHash)
+	v.SetDefault("validationreports", []string{})
+	v.SetDefault("validationbaseline", "")
+	v.SetDefault("triggermode", TriggerModeInterval)
+	v.SetDefault("bundlepollsecs", 10)
+	v.SetDefault("maxidlesecs", 3600)
+	v.SetDefault("triggeraddress", "")
+	v.SetDefault("maxdeletions", 0)
+	v.SetDefault("maxdeletionspercent", 0)
+	v.SetDefault("allowdeletions", false)
+	v.SetDefault("maxconsecutivefailures", 3)
+	v.SetDefault("backoffsecs", 30)
+	v.SetDefault("maxbackoffsecs", 600)
+	v.SetDefault("leaderelection", false)
+	v.SetDefault("leasedurationsecs", 60)
+	v.SetDefault("leaserenewsecs", 20)
+	v.SetDefault("runhistory", 10)
+	v.SetDefault("pushgateway", "")
 
 	v.BindEnv("timeout", "RUNNER_TIMEOUT")
 	v.BindEnv("usefeaturetoggle", "RUNNER_USE_FEATURE_TOGGLE")
@@ -44,6 +92,30 @@ func newRunnerConfig() *runnerConfig {
 	v.BindEnv("runonce", "RUN_ONCE")
 	v.BindEnv("sleepdurationsecs", "SLEEP_DURATION_SECS")
 	v.BindEnv("prometheusport", "PROMETHEUS_PORT")
+	v.BindEnv("planoutput", "PLAN_OUTPUT")
+	v.BindEnv("shutdowngraceperiodsecs", "SHUTDOWN_GRACE_PERIOD_SECS")
+	v.BindEnv("healthstuckfactor", "HEALTH_STUCK_FACTOR")
+	v.BindEnv("healthmaxfailures", "HEALTH_MAX_FAILURES")
+	v.BindEnv("shards", "SHARDS")
+	v.BindEnv("shardid", "SHARD_ID")
+	v.BindEnv("shardstrategy", "SHARD_STRATEGY")
+	v.BindEnv("validationreports", "VALIDATION_REPORTS")
+	v.BindEnv("validationbaseline", "VALIDATION_BASELINE")
+	v.BindEnv("triggermode", "TRIGGER_MODE")
+	v.BindEnv("bundlepollsecs", "BUNDLE_POLL_SECS")
+	v.BindEnv("maxidlesecs", "MAX_IDLE_SECS")
+	v.BindEnv("triggeraddress", "TRIGGER_ADDRESS")
+	v.BindEnv("maxdeletions", "MAX_DELETIONS")
+	v.BindEnv("maxdeletionspercent", "MAX_DELETIONS_PERCENT")
+	v.BindEnv("allowdeletions", "ALLOW_DELETIONS")
+	v.BindEnv("maxconsecutivefailures", "MAX_CONSECUTIVE_FAILURES")
+	v.BindEnv("backoffsecs", "BACKOFF_SECS")
+	v.BindEnv("maxbackoffsecs", "MAX_BACKOFF_SECS")
+	v.BindEnv("leaderelection", "LEADER_ELECTION")
+	v.BindEnv("leasedurationsecs", "LEASE_DURATION_SECS")
+	v.BindEnv("leaserenewsecs", "LEASE_RENEW_SECS")
+	v.BindEnv("runhistory", "RUN_HISTORY")
+	v.BindEnv("pushgateway", "PUSHGATEWAY_URL")
 
 	if err := v.Unmarshal(&ic); err != nil {
 		util.Log().Fatalw("Error while unmarshalling configuration %s", err.Error())
@@ -52,6 +124,18 @@ func newRunnerConfig() *runnerConfig {
 	return &ic
 }
 
+// newIntegrationRunnerConfig creates a runnerConfig for the integration name, settings in the
+// integrations.<name> section override the global ones
+func newIntegrationRunnerConfig(name string) *runnerConfig {
+	ic := newRunnerConfig()
+	if sub := viper.Sub("integrations." + name); sub != nil {
+		if err := sub.Unmarshal(ic); err != nil {
+			util.Log().Fatalw("Error while unmarshalling integration configuration", "integration", name, "error", err.Error())
+		}
+	}
+	return ic
+}
+
 func isFeatureEnabled(ctx context.Context, runnable string) (bool, error) {
 	client, err := unleash.NewUnleashClient()
 	if err != nil {
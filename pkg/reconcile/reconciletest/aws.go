@@ -0,0 +1,13 @@
+package reconciletest
+
+import (
+	"testing"
+
+	"github.com/app-sre/go-qontract-reconcile/pkg/aws/mock"
+	"github.com/golang/mock/gomock"
+)
+
+// NewAWSMock returns the generated aws.Client mock, expectations are verified when the test finishes
+func NewAWSMock(t testing.TB) *mock.MockClient {
+	return mock.NewMockClient(gomock.NewController(t))
+}
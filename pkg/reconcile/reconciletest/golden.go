@@ -0,0 +1,78 @@
+package reconciletest
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/app-sre/go-qontract-reconcile/pkg/reconcile"
+	"github.com/stretchr/testify/assert"
+)
+
+// UpdateGoldenEnv is the environment variable, that makes the Assert functions write golden files instead of comparing them
+const UpdateGoldenEnv = "UPDATE_GOLDEN"
+
+// AssertGolden compares got with testdata/<name>.golden
+func AssertGolden(t testing.TB, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error while reading golden file, run with %s=1 to create it: %s", UpdateGoldenEnv, err.Error())
+	}
+	assert.Equal(t, string(want), string(got), "%s differs, run with %s=1 to update it", path, UpdateGoldenEnv)
+}
+
+// AssertJSONGolden compares the indented JSON encoding of v with testdata/<name>.golden
+func AssertJSONGolden(t testing.TB, name string, v interface{}) {
+	t.Helper()
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	AssertGolden(t, name, buf.Bytes())
+}
+
+// AssertGolden compares inventory and plan with testdata/<name>.inventory.golden and testdata/<name>.plan.golden
+func (r *Result) AssertGolden(t testing.TB, name string) {
+	t.Helper()
+	AssertJSONGolden(t, name+".inventory", r.Inventory.State)
+	if r.Plan == nil {
+		t.Fatalf("No plan, %s failed: %v", r.Phase, r.Err)
+	}
+	var buf bytes.Buffer
+	if err := r.Plan.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	AssertGolden(t, name+".plan", buf.Bytes())
+}
+
+type goldenValidationError struct {
+	Path       string             `json:"path"`
+	Validation string             `json:"validation"`
+	Severity   reconcile.Severity `json:"severity,omitempty"`
+	Message    string             `json:"message"`
+}
+
+// AssertValidationGolden compares validationErrors with testdata/<name>.golden
+func AssertValidationGolden(t testing.TB, name string, validationErrors []reconcile.ValidationError) {
+	t.Helper()
+	entries := []goldenValidationError{}
+	for _, e := range validationErrors {
+		entries = append(entries, goldenValidationError{Path: e.Path, Validation: e.Validation, Severity: e.Severity, Message: e.Error.Error()})
+	}
+	AssertJSONGolden(t, name, entries)
+}
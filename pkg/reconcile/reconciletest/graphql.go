@@ -0,0 +1,82 @@
+package reconciletest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/app-sre/go-qontract-reconcile/pkg/gql"
+)
+
+// FakeGraphQL serves canned responses for GraphQL operations, like qontract-server would
+type FakeGraphQL struct {
+	Server *httptest.Server
+	// Responses maps operation names to the data returned for them
+	Responses map[string]interface{}
+
+	mu         sync.Mutex
+	operations []string
+}
+
+type graphqlRequest struct {
+	OperationName string `json:"operationName"`
+}
+
+// NewFakeGraphQL starts a FakeGraphQL and points the graphql configuration to it
+func NewFakeGraphQL(t testing.TB, responses map[string]interface{}) *FakeGraphQL {
+	f := &FakeGraphQL{Responses: responses}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle(t)))
+	t.Cleanup(f.Server.Close)
+	t.Setenv("GRAPHQL_SERVER", f.Server.URL+"/graphql")
+	t.Setenv("GRAPHQL_RETRIES", "0")
+	return f
+}
+
+func (f *FakeGraphQL) handle(t testing.TB) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req graphqlRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.operations = append(f.operations, req.OperationName)
+		f.mu.Unlock()
+
+		data, ok := f.Responses[req.OperationName]
+		if !ok && req.OperationName == "integrations" {
+			// QontractClient checks the schemas of every response against the integrations query
+			data, ok = map[string]interface{}{"integrations": []interface{}{}}, true
+		}
+		if !ok {
+			t.Errorf("Unexpected GraphQL operation %q", req.OperationName)
+			http.Error(w, "unexpected operation", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data":       data,
+			"extensions": map[string]interface{}{"schemas": []string{}},
+		})
+	}
+}
+
+// Operations returns the names of all received operations
+func (f *FakeGraphQL) Operations() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string{}, f.operations...)
+}
+
+// Client returns a QontractClient using the FakeGraphQL
+func (f *FakeGraphQL) Client(t testing.TB) *gql.QontractClient {
+	t.Helper()
+	client, err := gql.NewQontractClient(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
@@ -0,0 +1,11 @@
+package reconciletest
+
+import "github.com/Khan/genqlient/graphql"
+
+func newGraphQLRequest(operation string) *graphql.Request {
+	return &graphql.Request{OpName: operation, Query: "query " + operation + " { }"}
+}
+
+func newGraphQLResponse(data interface{}) *graphql.Response {
+	return &graphql.Response{Data: data}
+}
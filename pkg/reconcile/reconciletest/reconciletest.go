@@ -0,0 +1,52 @@
+// Package reconciletest runs Integrations and Validations in tests against fake backends
+// and compares the results with golden files
+package reconciletest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/app-sre/go-qontract-reconcile/pkg/reconcile"
+)
+
+// Options configure how Run and RunValidation execute a runnable
+type Options struct {
+	// Name of the integration, it is added to the context like the runners do
+	Name string
+	// SkipSetup skips Setup and Teardown, for runnables whose clients are injected by the test
+	SkipSetup bool
+	// DryRun skips Reconcile
+	DryRun bool
+}
+
+// Result is the outcome of running all phases of an Integration
+type Result struct {
+	reconcile.RunResult
+}
+
+func (o Options) context() context.Context {
+	return context.WithValue(context.Background(), reconcile.ContextIngetrationNameKey, o.Name)
+}
+
+// Run runs all phases of integration once with reconcile.RunOnce, like IntegrationRunner does. The runner
+// configuration is read like in the runner, i.e. set SHARDS or MAX_DELETIONS with t.Setenv.
+func Run(t testing.TB, integration reconcile.Integration, opts Options) *Result {
+	t.Helper()
+	result := reconcile.RunOnce(context.Background(), integration, opts.Name, reconcile.RunOnceOptions{
+		DryRun:    opts.DryRun,
+		SkipSetup: opts.SkipSetup,
+	})
+	return &Result{RunResult: *result}
+}
+
+// RunValidation runs Setup and Validate of validation once, like ValidationRunner does
+func RunValidation(t testing.TB, validation reconcile.Validation, opts Options) ([]reconcile.ValidationError, error) {
+	t.Helper()
+	ctx := opts.context()
+	if !opts.SkipSetup {
+		if err := validation.Setup(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return validation.Validate(ctx)
+}
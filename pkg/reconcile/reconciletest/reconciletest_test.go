@@ -0,0 +1,209 @@
+package reconciletest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/app-sre/go-qontract-reconcile/pkg/reconcile"
+	"github.com/app-sre/go-qontract-reconcile/pkg/state"
+	"github.com/app-sre/go-qontract-reconcile/pkg/vault"
+	"github.com/stretchr/testify/assert"
+)
+
+// secretCopier copies vault secrets from input to output and remembers copied secrets in state
+type secretCopier struct {
+	vault *vault.Client
+	state state.Persistence
+}
+
+func (s *secretCopier) Setup(context.Context) error {
+	var err error
+	s.vault, err = vault.NewVaultClient()
+	return err
+}
+
+func (s *secretCopier) CurrentState(ctx context.Context, ri *reconcile.ResourceInventory) error {
+	secrets, err := s.vault.ListSecrets("output")
+	if err != nil {
+		return err
+	}
+	for _, key := range secrets.Keys {
+		ri.AddResourceState(key, &reconcile.ResourceState{Current: key})
+	}
+	return nil
+}
+
+func (s *secretCopier) DesiredState(ctx context.Context, ri *reconcile.ResourceInventory) error {
+	secrets, err := s.vault.ListSecrets("input")
+	if err != nil {
+		return err
+	}
+	for _, key := range secrets.Keys {
+		rs := ri.GetResourceState(key)
+		if rs == nil {
+			rs = &reconcile.ResourceState{}
+			ri.AddResourceState(key, rs)
+		}
+		rs.Desired = key
+	}
+	return nil
+}
+
+func (s *secretCopier) Reconcile(ctx context.Context, ri *reconcile.ResourceInventory) error {
+	return reconcile.ForEachTarget(ctx, ri.State, func(ctx context.Context, target string, rs *reconcile.ResourceState) error {
+		if rs.Current != nil {
+			return nil
+		}
+		secret, err := s.vault.ReadSecret("input/" + target)
+		if err != nil {
+			return err
+		}
+		if _, err := s.vault.WriteSecret("output/"+target, secret.Data); err != nil {
+			return err
+		}
+		return s.state.Add(ctx, target, secret.Data)
+	})
+}
+
+func (s *secretCopier) LogDiff(*reconcile.ResourceInventory) {}
+
+func TestRun(t *testing.T) {
+	fakeVault := NewFakeVault(t, map[string]map[string]interface{}{
+		"input/a":  {"password": "a"},
+		"input/b":  {"password": "b"},
+		"output/a": {"password": "a"},
+	})
+	memoryState := NewMemoryState()
+	integration := &secretCopier{state: memoryState}
+
+	result := Run(t, integration, Options{Name: "secret-copier"})
+	assert.NoError(t, result.Err)
+	result.AssertGolden(t, "secret-copier")
+	AssertJSONGolden(t, "secret-copier.state", memoryState.Objects())
+	assert.Equal(t, map[string]interface{}{"password": "b"}, fakeVault.Secret("output/b"))
+}
+
+func TestRunFailingPhase(t *testing.T) {
+	fakeVault := NewFakeVault(t, nil)
+	fakeVault.Server.Close()
+	t.Setenv("VAULT_MAX_RETRIES", "0")
+	integration := &secretCopier{state: NewMemoryState()}
+
+	result := Run(t, integration, Options{Name: "secret-copier"})
+	assert.Equal(t, "current_state", result.Phase)
+	assert.Error(t, result.Err)
+	assert.Nil(t, result.Plan)
+}
+
+func TestRunUsesRunnerConfig(t *testing.T) {
+	NewFakeVault(t, map[string]map[string]interface{}{
+		"input/a": {"password": "a"},
+		"input/b": {"password": "b"},
+	})
+	t.Setenv("SHARDS", "2")
+	t.Setenv("SHARD_ID", "1")
+
+	result := Run(t, &secretCopier{state: NewMemoryState()}, Options{Name: "secret-copier", DryRun: true})
+	assert.NoError(t, result.Err)
+	assert.Len(t, result.Inventory.State, 1)
+	assert.NotNil(t, result.Inventory.GetResourceState("b"))
+}
+
+// panickingCopier panics in LogDiff
+type panickingCopier struct {
+	secretCopier
+}
+
+func (p *panickingCopier) LogDiff(*reconcile.ResourceInventory) {
+	panic("diff failed")
+}
+
+func TestRunRecoversPanic(t *testing.T) {
+	NewFakeVault(t, nil)
+
+	result := Run(t, &panickingCopier{}, Options{Name: "secret-copier"})
+	assert.Equal(t, "plan", result.Phase)
+	assert.EqualError(t, result.Err, "panic during plan: diff failed")
+}
+
+type failingValidation struct{}
+
+func (failingValidation) Setup(context.Context) error {
+	return nil
+}
+
+func (failingValidation) Validate(context.Context) ([]reconcile.ValidationError, error) {
+	return []reconcile.ValidationError{{
+		Path:       "/users/a.yml",
+		Validation: "username",
+		Error:      errors.New("invalid username"),
+	}}, nil
+}
+
+func TestRunValidation(t *testing.T) {
+	validationErrors, err := RunValidation(t, failingValidation{}, Options{Name: "test"})
+	assert.NoError(t, err)
+	AssertValidationGolden(t, "validation", validationErrors)
+}
+
+func TestFakeGraphQL(t *testing.T) {
+	fake := NewFakeGraphQL(t, map[string]interface{}{
+		"users": map[string]interface{}{"users": []string{"a"}},
+	})
+	client := fake.Client(t)
+
+	ctx := context.WithValue(context.Background(), reconcile.ContextIngetrationNameKey, "test")
+	var data struct {
+		Users []string `json:"users"`
+	}
+	err := client.MakeRequest(ctx, newGraphQLRequest("users"), newGraphQLResponse(&data))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, data.Users)
+	assert.Equal(t, []string{"users", "integrations"}, fake.Operations())
+}
+
+func TestMemoryState(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryState()
+	assert.NoError(t, s.Add(ctx, "a", map[string]string{"b": "c"}))
+
+	exists, err := s.Exists(ctx, "a")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	var value map[string]string
+	assert.NoError(t, s.Get(ctx, "a", &value))
+	assert.Equal(t, "c", value["b"])
+
+	assert.NoError(t, s.Add(ctx, "b/c", "d"))
+	keys, err := s.List(ctx, "b/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b/c"}, keys)
+
+	assert.NoError(t, s.Rm(ctx, "a"))
+	assert.Error(t, s.Get(ctx, "a", &value), fmt.Sprintf("key %s not found", "a"))
+}
+
+func TestMemoryStateConditionalWrites(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryState()
+
+	version, err := s.AddIfVersion(ctx, "a", "b", "")
+	assert.NoError(t, err)
+	_, err = s.AddIfVersion(ctx, "a", "c", "")
+	assert.True(t, state.IsConflict(err))
+
+	var value string
+	readVersion, err := s.GetVersioned(ctx, "a", &value)
+	assert.NoError(t, err)
+	assert.Equal(t, version, readVersion)
+
+	// Writing the same value again is a new version
+	assert.NoError(t, s.Add(ctx, "a", "b"))
+	assert.True(t, state.IsConflict(s.RmIfVersion(ctx, "a", version)))
+	readVersion, err = s.GetVersioned(ctx, "a", &value)
+	assert.NoError(t, err)
+	assert.NoError(t, s.RmIfVersion(ctx, "a", readVersion))
+}
@@ -0,0 +1,141 @@
+package reconciletest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/app-sre/go-qontract-reconcile/pkg/state"
+)
+
+var _ state.Persistence = &MemoryState{}
+
+// MemoryState implements state.Persistence in memory, values are stored JSON encoded like S3State does.
+// Versions are generations, increased on every write.
+type MemoryState struct {
+	mu         sync.Mutex
+	objects    map[string][]byte
+	versions   map[string]int64
+	generation int64
+}
+
+// NewMemoryState creates an empty MemoryState
+func NewMemoryState() *MemoryState {
+	return &MemoryState{objects: map[string][]byte{}, versions: map[string]int64{}}
+}
+
+// Exists checks if key exists
+func (m *MemoryState) Exists(_ context.Context, key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.objects[key]
+	return ok, nil
+}
+
+// Add stores value as key
+func (m *MemoryState) Add(_ context.Context, key string, value interface{}) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.put(key, b)
+	return nil
+}
+
+// AddIfVersion stores value as key if its version is unchanged
+func (m *MemoryState) AddIfVersion(_ context.Context, key string, value interface{}, version string) (string, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.version(key) != version {
+		return "", &state.ConflictError{Key: key, Version: version}
+	}
+	return m.put(key, b), nil
+}
+
+func (m *MemoryState) put(key string, b []byte) string {
+	m.generation++
+	m.objects[key] = b
+	m.versions[key] = m.generation
+	return m.version(key)
+}
+
+// version returns the version of key, an empty string if it does not exist
+func (m *MemoryState) version(key string) string {
+	if _, ok := m.objects[key]; !ok {
+		return ""
+	}
+	return strconv.FormatInt(m.versions[key], 10)
+}
+
+// Rm removes key
+func (m *MemoryState) Rm(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	delete(m.versions, key)
+	return nil
+}
+
+// RmIfVersion removes key if its version is unchanged
+func (m *MemoryState) RmIfVersion(_ context.Context, key string, version string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.objects[key]; !ok || m.version(key) != version {
+		return &state.ConflictError{Key: key, Version: version}
+	}
+	delete(m.objects, key)
+	delete(m.versions, key)
+	return nil
+}
+
+// Get decodes the value of key into value
+func (m *MemoryState) Get(ctx context.Context, key string, value interface{}) error {
+	_, err := m.GetVersioned(ctx, key, value)
+	return err
+}
+
+// GetVersioned decodes the value of key into value and returns its version
+func (m *MemoryState) GetVersioned(_ context.Context, key string, value interface{}) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.objects[key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found", key)
+	}
+	return m.version(key), json.Unmarshal(b, value)
+}
+
+// List returns all keys starting with prefix
+func (m *MemoryState) List(_ context.Context, prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := []string{}
+	for key := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Objects returns the raw JSON of all stored keys, it can be used with AssertJSONGolden
+func (m *MemoryState) Objects() map[string]json.RawMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := map[string]json.RawMessage{}
+	for key, b := range m.objects {
+		keys[key] = json.RawMessage(b)
+	}
+	return keys
+}
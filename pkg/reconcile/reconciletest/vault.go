@@ -0,0 +1,118 @@
+package reconciletest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/app-sre/go-qontract-reconcile/pkg/vault"
+)
+
+// FakeVault is an in-memory Vault serving the logical read, list, write and delete endpoints
+type FakeVault struct {
+	Server *httptest.Server
+
+	mu      sync.Mutex
+	secrets map[string]map[string]interface{}
+}
+
+// NewFakeVault starts a FakeVault with the given secrets and points the vault configuration to it
+func NewFakeVault(t testing.TB, secrets map[string]map[string]interface{}) *FakeVault {
+	f := &FakeVault{secrets: map[string]map[string]interface{}{}}
+	for path, data := range secrets {
+		f.secrets[strings.Trim(path, "/")] = data
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.Server.Close)
+	t.Setenv("VAULT_SERVER", f.Server.URL)
+	t.Setenv("VAULT_AUTHTYPE", "token")
+	t.Setenv("VAULT_TOKEN", "token")
+	return f
+}
+
+// Client returns a vault.Client using the FakeVault
+func (f *FakeVault) Client(t testing.TB) *vault.Client {
+	t.Helper()
+	client, err := vault.NewVaultClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// Secret returns the data of the secret at path, nil if it does not exist
+func (f *FakeVault) Secret(path string) map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.secrets[strings.Trim(path, "/")]
+}
+
+func (f *FakeVault) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1"), "/")
+
+	switch {
+	case r.Method == "LIST" || (r.Method == http.MethodGet && r.URL.Query().Get("list") == "true"):
+		keys := f.list(path)
+		if len(keys) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeVaultData(w, map[string]interface{}{"keys": keys})
+	case r.Method == http.MethodGet:
+		data, ok := f.secrets[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeVaultData(w, data)
+	case r.Method == http.MethodPut || r.Method == http.MethodPost:
+		data := map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.secrets[path] = data
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete:
+		delete(f.secrets, path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// list returns the direct children of path, sub paths end with a slash
+func (f *FakeVault) list(path string) []string {
+	prefix := ""
+	if path != "" {
+		prefix = path + "/"
+	}
+	seen := map[string]bool{}
+	for secretPath := range f.secrets {
+		if !strings.HasPrefix(secretPath, prefix) {
+			continue
+		}
+		key, _, isDir := strings.Cut(strings.TrimPrefix(secretPath, prefix), "/")
+		if isDir {
+			key += "/"
+		}
+		seen[key] = true
+	}
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeVaultData(w http.ResponseWriter, data map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
@@ -0,0 +1,275 @@
+package reconcile
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	// ReportFormatJSON writes validation errors as JSON
+	ReportFormatJSON = "json"
+	// ReportFormatJUnit writes validation errors as JUnit XML
+	ReportFormatJUnit = "junit"
+	// ReportFormatSARIF writes validation errors as SARIF 2.1.0
+	ReportFormatSARIF = "sarif"
+)
+
+// reportWriter writes the ValidationErrors of a Validation called name in a machine-readable format
+type reportWriter func(w io.Writer, name string, validationErrors []ValidationError) error
+
+var reportWriters = map[string]reportWriter{
+	ReportFormatJSON:  writeJSONReport,
+	ReportFormatJUnit: writeJUnitReport,
+	ReportFormatSARIF: writeSARIFReport,
+	// The baseline is written from all findings, including the ones of the current baseline
+	ReportFormatBaseline: writeBaselineReport,
+}
+
+// reportTarget is a single configured report, parsed from "format:path"
+type reportTarget struct {
+	format string
+	path   string
+}
+
+func parseReportTargets(reports []string) ([]reportTarget, error) {
+	targets := []reportTarget{}
+	for _, report := range reports {
+		if report == "" {
+			continue
+		}
+		format, path, found := strings.Cut(report, ":")
+		if !found || path == "" {
+			return nil, fmt.Errorf("invalid report %q, expected format:path", report)
+		}
+		if _, ok := reportWriters[format]; !ok {
+			return nil, fmt.Errorf("unknown report format %s", format)
+		}
+		targets = append(targets, reportTarget{format: format, path: path})
+	}
+	return targets, nil
+}
+
+// writeReports writes all configured reports, all are the findings before filtering the baseline
+func (v *ValidationRunner) writeReports(validationErrors, all []ValidationError) error {
+	targets, err := parseReportTargets(v.config.ValidationReports)
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		reported := validationErrors
+		if target.format == ReportFormatBaseline {
+			reported = all
+		}
+		if err := writeReportFile(target, v.Name, reported); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeReportFile(target reportTarget, name string, validationErrors []ValidationError) error {
+	f, err := os.Create(target.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return reportWriters[target.format](f, name, validationErrors)
+}
+
+type jsonReportEntry struct {
+	Path       string   `json:"path"`
+	Validation string   `json:"validation"`
+	Severity   Severity `json:"severity"`
+	Message    string   `json:"message"`
+}
+
+type jsonReport struct {
+	Name   string            `json:"name"`
+	Errors []jsonReportEntry `json:"errors"`
+}
+
+func writeJSONReport(w io.Writer, name string, validationErrors []ValidationError) error {
+	report := jsonReport{
+		Name:   name,
+		Errors: []jsonReportEntry{},
+	}
+	for _, e := range validationErrors {
+		report.Errors = append(report.Errors, jsonReportEntry{
+			Path:       e.Path,
+			Validation: e.Validation,
+			Severity:   e.GetSeverity(),
+			Message:    e.Error.Error(),
+		})
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+func writeJUnitReport(w io.Writer, name string, validationErrors []ValidationError) error {
+	suite := junitTestSuite{
+		Name:      name,
+		TestCases: []junitTestCase{},
+	}
+	failures := 0
+	for _, e := range validationErrors {
+		testCase := junitTestCase{
+			Name:      e.Path,
+			ClassName: e.Validation,
+		}
+		// JUnit has no severities, only errors are failures
+		if e.GetSeverity() == SeverityError {
+			testCase.Failure = &junitFailure{
+				Message: e.Error.Error(),
+				Type:    e.Validation,
+				Text:    fmt.Sprintf("%s: %s", e.Path, e.Error.Error()),
+			}
+			failures++
+		} else {
+			testCase.SystemOut = fmt.Sprintf("%s: %s", e.GetSeverity(), e.Error.Error())
+		}
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+	// A suite without test cases is reported as skipped by most CI systems
+	if len(suite.TestCases) == 0 {
+		suite.TestCases = append(suite.TestCases, junitTestCase{Name: name, ClassName: name})
+	}
+	suite.Tests = len(suite.TestCases)
+	suite.Failures = failures
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suite); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifReport struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+var sarifLevels = map[Severity]string{
+	SeverityError:   "error",
+	SeverityWarning: "warning",
+	SeverityInfo:    "note",
+}
+
+func writeSARIFReport(w io.Writer, name string, validationErrors []ValidationError) error {
+	rules := map[string]bool{}
+	results := []sarifResult{}
+	for _, e := range validationErrors {
+		rules[e.Validation] = true
+		results = append(results, sarifResult{
+			RuleID:  e.Validation,
+			Level:   sarifLevels[e.GetSeverity()],
+			Message: sarifMessage{Text: e.Error.Error()},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					// Paths are absolute within the data directory, SARIF expects relative URIs
+					ArtifactLocation: sarifArtifactLocation{URI: strings.TrimPrefix(e.Path, "/")},
+				},
+			}},
+		})
+	}
+
+	ruleIDs := make([]string, 0, len(rules))
+	for id := range rules {
+		ruleIDs = append(ruleIDs, id)
+	}
+	sort.Strings(ruleIDs)
+	sarifRules := make([]sarifRule, 0, len(ruleIDs))
+	for _, id := range ruleIDs {
+		sarifRules = append(sarifRules, sarifRule{ID: id})
+	}
+
+	report := sarifReport{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool: sarifTool{
+				Driver: sarifDriver{
+					Name:  name,
+					Rules: sarifRules,
+				},
+			},
+			Results: results,
+		}},
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
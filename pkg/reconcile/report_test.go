@@ -0,0 +1,136 @@
+package reconcile
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testValidationErrors = []ValidationError{
+	{Path: "/users/foo.yml", Validation: "validate_pgp_key", Error: fmt.Errorf("invalid key")},
+	{Path: "/users/bar.yml", Validation: "validate_github_login", Error: fmt.Errorf("unknown login")},
+}
+
+func TestParseReportTargets(t *testing.T) {
+	targets, err := parseReportTargets([]string{"json:/tmp/report.json", "", "sarif:c:/report.sarif"})
+	assert.NoError(t, err)
+	assert.Equal(t, []reportTarget{
+		{format: ReportFormatJSON, path: "/tmp/report.json"},
+		{format: ReportFormatSARIF, path: "c:/report.sarif"},
+	}, targets)
+
+	_, err = parseReportTargets([]string{"yaml:/tmp/report.yml"})
+	assert.ErrorContains(t, err, "unknown report format yaml")
+
+	_, err = parseReportTargets([]string{"json"})
+	assert.ErrorContains(t, err, "expected format:path")
+}
+
+func TestWriteJSONReport(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, writeJSONReport(&buf, "test", testValidationErrors))
+
+	var report jsonReport
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &report))
+	assert.Equal(t, "test", report.Name)
+	assert.Equal(t, jsonReportEntry{Path: "/users/foo.yml", Validation: "validate_pgp_key", Severity: SeverityError, Message: "invalid key"}, report.Errors[0])
+}
+
+func TestWriteJUnitReport(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, writeJUnitReport(&buf, "test", testValidationErrors))
+
+	var suite junitTestSuite
+	assert.NoError(t, xml.Unmarshal(buf.Bytes(), &suite))
+	assert.Equal(t, 2, suite.Tests)
+	assert.Equal(t, 2, suite.Failures)
+	assert.Equal(t, "/users/bar.yml", suite.TestCases[1].Name)
+	assert.Equal(t, "validate_github_login", suite.TestCases[1].ClassName)
+	assert.Equal(t, "unknown login", suite.TestCases[1].Failure.Message)
+}
+
+func TestWriteJUnitReportWithoutErrors(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, writeJUnitReport(&buf, "test", []ValidationError{}))
+
+	var suite junitTestSuite
+	assert.NoError(t, xml.Unmarshal(buf.Bytes(), &suite))
+	assert.Equal(t, 1, suite.Tests)
+	assert.Equal(t, 0, suite.Failures)
+	assert.Nil(t, suite.TestCases[0].Failure)
+}
+
+func TestWriteSARIFReport(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, writeSARIFReport(&buf, "test", testValidationErrors))
+
+	var report sarifReport
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &report))
+	assert.Equal(t, "2.1.0", report.Version)
+	assert.Len(t, report.Runs, 1)
+	assert.Equal(t, []sarifRule{{ID: "validate_github_login"}, {ID: "validate_pgp_key"}}, report.Runs[0].Tool.Driver.Rules)
+	assert.Equal(t, "users/foo.yml", report.Runs[0].Results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	assert.Equal(t, "invalid key", report.Runs[0].Results[0].Message.Text)
+}
+
+func TestValidationRunnerWritesReports(t *testing.T) {
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "report.json")
+	junitPath := filepath.Join(dir, "report.xml")
+	os.Setenv("VALIDATION_REPORTS", fmt.Sprintf("json:%s,junit:%s", jsonPath, junitPath))
+	defer os.Unsetenv("VALIDATION_REPORTS")
+
+	tv := TestValidation{
+		ReturnValidations: true,
+	}
+	vr := NewValidationRunner(&tv, "test")
+	var exitCode int
+	vr.Exiter = func(i int) {
+		exitCode = i
+	}
+	vr.Run()
+	assert.Equal(t, 1, exitCode)
+
+	assert.FileExists(t, jsonPath)
+	content, err := os.ReadFile(junitPath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `<failure message="test" type="test">`)
+}
+
+var testSeverityValidationErrors = []ValidationError{
+	{Path: "/users/foo.yml", Validation: "validate_pgp_key", Error: fmt.Errorf("invalid key")},
+	{Path: "/users/bar.yml", Validation: "validate_github_login", Error: fmt.Errorf("renamed login"), Severity: SeverityWarning},
+	{Path: "/users/baz.yml", Validation: "validate_username", Error: fmt.Errorf("uppercase"), Severity: SeverityInfo},
+}
+
+func TestWriteJUnitReportSeverities(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, writeJUnitReport(&buf, "test", testSeverityValidationErrors))
+
+	var suite junitTestSuite
+	assert.NoError(t, xml.Unmarshal(buf.Bytes(), &suite))
+	assert.Equal(t, 3, suite.Tests)
+	assert.Equal(t, 1, suite.Failures)
+	assert.NotNil(t, suite.TestCases[0].Failure)
+	assert.Nil(t, suite.TestCases[1].Failure)
+	assert.Equal(t, "warning: renamed login", suite.TestCases[1].SystemOut)
+}
+
+func TestWriteSARIFReportSeverities(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, writeSARIFReport(&buf, "test", testSeverityValidationErrors))
+
+	var report sarifReport
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &report))
+	levels := []string{}
+	for _, result := range report.Runs[0].Results {
+		levels = append(levels, result.Level)
+	}
+	assert.Equal(t, []string{"error", "warning", "note"}, levels)
+}
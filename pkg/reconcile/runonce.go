@@ -0,0 +1,55 @@
+package reconcile
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// phaseOrder lists all phases of a run in the order they run
+var phaseOrder = []string{phaseSetup, phaseCurrentState, phaseDesiredState, phaseShard, phasePlan, phaseDeletionLimit,
+	phaseValidate, phaseReconcile, phasePostReconcile, phaseTeardown}
+
+// RunOnceOptions override the runner configuration of RunOnce
+type RunOnceOptions struct {
+	// DryRun skips Reconcile
+	DryRun bool
+	// SkipSetup skips Setup and Teardown, for integrations whose clients are injected by tests
+	SkipSetup bool
+}
+
+// RunResult is the outcome of RunOnce
+type RunResult struct {
+	Inventory *ResourceInventory
+	// Plan is nil if a phase before Plan failed
+	Plan *Plan
+	// Phase is the first phase, that failed
+	Phase string
+	// Err is the error of the run
+	Err error
+}
+
+// RunOnce runs all phases of runnable once like the IntegrationRunner does, including shard filter, deletion limit
+// and panic recovery. The configuration of the integration name is used, metrics are kept in a private registry.
+// It is used to run integrations in tests.
+func RunOnce(ctx context.Context, runnable Integration, name string, opts RunOnceOptions) *RunResult {
+	config := newIntegrationRunnerConfig(name)
+	config.DryRun = opts.DryRun
+	i := newIntegrationRunner(runnable, name, config, prometheus.NewRegistry())
+	i.skipSetup = opts.SkipSetup
+
+	result := &RunResult{Inventory: NewResourceInventory()}
+	i.inspect = func(ri *ResourceInventory, plan *Plan) {
+		result.Inventory = ri
+		result.Plan = plan
+	}
+	summary := &RunSummary{}
+	result.Err = i.runIntegration(withRunSummary(ctx, summary))
+	for _, phase := range phaseOrder {
+		if _, failed := summary.PhaseErrors[phase]; failed {
+			result.Phase = phase
+			break
+		}
+	}
+	return result
+}
@@ -0,0 +1,82 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/app-sre/go-qontract-reconcile/pkg/util"
+)
+
+// exitCodeDeletionLimit is used if a run was aborted because it planned too many deletions
+const exitCodeDeletionLimit = 3
+
+// DeletionCounter can be implemented by Integrations, whose Reconcile deletes resources that are not
+// ActionDelete entries of their Plan. Integrations without it are limited by their ActionDelete entries.
+type DeletionCounter interface {
+	PlannedDeletions(ri *ResourceInventory, plan *Plan) int
+}
+
+// fallibleDeletionCounter is implemented by adapters, whose count of planned deletions can fail
+type fallibleDeletionCounter interface {
+	countDeletions(ri *ResourceInventory, plan *Plan) (int, error)
+}
+
+// DeletionLimitError is returned if a run plans more deletions than the configured limits allow
+type DeletionLimitError struct {
+	Deletions int
+	Targets   int
+	Limit     string
+}
+
+func (e *DeletionLimitError) Error() string {
+	return fmt.Sprintf("%d planned deletions for %d targets exceed the limit of %s, set allowdeletions to override", e.Deletions, e.Targets, e.Limit)
+}
+
+// exitCodeFor returns the exit code for an error returned by runIntegration
+func exitCodeFor(err error) int {
+	var deletionLimitError *DeletionLimitError
+	if errors.As(err, &deletionLimitError) {
+		return exitCodeDeletionLimit
+	}
+	return 1
+}
+
+// plannedDeletions counts the deletions of plan, an error or panic of a DeletionCounter fails the run
+func (i *IntegrationRunner) plannedDeletions(ctx context.Context, phases *phaseMetrics, ri *ResourceInventory, plan *Plan) (deletions int, err error) {
+	err = recoverPhase(ctx, phases, phaseDeletionLimit, func() error {
+		var countErr error
+		if counter, ok := i.Runnable.(fallibleDeletionCounter); ok {
+			deletions, countErr = counter.countDeletions(ri, plan)
+		} else if counter, ok := i.Runnable.(DeletionCounter); ok {
+			deletions = counter.PlannedDeletions(ri, plan)
+		} else {
+			deletions = plan.Count(ActionDelete)
+		}
+		return countErr
+	})
+	runSummaryFrom(ctx).recordPhase(phaseDeletionLimit, err)
+	return deletions, err
+}
+
+// checkDeletionLimit returns a DeletionLimitError if deletions exceed MaxDeletions or MaxDeletionsPercent
+// of all targets, unless AllowDeletions is set
+func (i *IntegrationRunner) checkDeletionLimit(ri *ResourceInventory, deletions int) error {
+	i.metrics.setPlannedDeletions(deletions)
+
+	var limit string
+	switch {
+	case i.config.MaxDeletions > 0 && deletions > i.config.MaxDeletions:
+		limit = fmt.Sprintf("%d", i.config.MaxDeletions)
+	case i.config.MaxDeletionsPercent > 0 && deletions*100 > i.config.MaxDeletionsPercent*len(ri.State):
+		limit = fmt.Sprintf("%d%%", i.config.MaxDeletionsPercent)
+	default:
+		return nil
+	}
+	err := &DeletionLimitError{Deletions: deletions, Targets: len(ri.State), Limit: limit}
+	if i.config.AllowDeletions {
+		util.Log().Warnw("Deletion limit exceeded, continuing as allowdeletions is set", "error", err.Error())
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,82 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// deletingIntegration deletes all of its targets
+type deletingIntegration struct {
+	TestIntegration
+	targets int
+}
+
+func (d *deletingIntegration) CurrentState(_ context.Context, ri *ResourceInventory) error {
+	for i := 0; i < d.targets; i++ {
+		ri.AddResourceState(string(rune('a'+i)), &ResourceState{Current: "exists"})
+	}
+	return nil
+}
+
+func TestDeletionLimit(t *testing.T) {
+	testCases := []struct {
+		name    string
+		config  runnerConfig
+		aborted bool
+	}{
+		{name: "no limits", config: runnerConfig{}},
+		{name: "below absolute limit", config: runnerConfig{MaxDeletions: 4}},
+		{name: "above absolute limit", config: runnerConfig{MaxDeletions: 3}, aborted: true},
+		{name: "above percentage limit", config: runnerConfig{MaxDeletionsPercent: 50}, aborted: true},
+		{name: "override", config: runnerConfig{MaxDeletions: 3, AllowDeletions: true}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			integration := &deletingIntegration{targets: 4}
+			runner := newTestRunner(t, integration, withConfig(&tc.config))
+
+			err := runner.runIntegration(context.Background())
+			assert.Equal(t, 4.0, testutil.ToFloat64(runner.metrics.deletions))
+			if tc.aborted {
+				var deletionLimitError *DeletionLimitError
+				assert.True(t, errors.As(err, &deletionLimitError))
+				assert.Equal(t, exitCodeDeletionLimit, exitCodeFor(err))
+				assert.False(t, integration.ReconcileRun)
+				assert.Equal(t, 1.0, testutil.ToFloat64(runner.metrics.deletionAbort))
+			} else {
+				assert.NoError(t, err)
+				assert.True(t, integration.ReconcileRun)
+			}
+		})
+	}
+}
+
+func TestDeletionLimitDryRun(t *testing.T) {
+	integration := &deletingIntegration{targets: 4}
+	runner := newTestRunner(t, integration, withConfig(&runnerConfig{DryRun: true, MaxDeletions: 1}))
+	assert.NoError(t, runner.runIntegration(context.Background()))
+	assert.Equal(t, 0.0, testutil.ToFloat64(runner.metrics.deletionAbort))
+}
+
+type countingIntegration struct {
+	deletingIntegration
+}
+
+func (c *countingIntegration) PlannedDeletions(ri *ResourceInventory, _ *Plan) int {
+	return 10 * len(ri.State)
+}
+
+func TestDeletionCounter(t *testing.T) {
+	runner := newTestRunner(t, &countingIntegration{deletingIntegration{targets: 1}}, withConfig(&runnerConfig{MaxDeletions: 5}))
+	err := runner.runIntegration(context.Background())
+	assert.ErrorContains(t, err, "10 planned deletions for 1 targets exceed the limit of 5")
+}
+
+func TestExitCodeFor(t *testing.T) {
+	assert.Equal(t, 1, exitCodeFor(errors.New("failed")))
+	assert.Equal(t, exitCodeDeletionLimit, exitCodeFor(&DeletionLimitError{}))
+}
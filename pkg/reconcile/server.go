@@ -0,0 +1,52 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/app-sre/go-qontract-reconcile/pkg/metrics"
+	"github.com/app-sre/go-qontract-reconcile/pkg/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricsServerShutdownTimeout is the maximum time to wait for open metrics requests on shutdown
+const metricsServerShutdownTimeout = 5 * time.Second
+
+// startServer serves metrics of registry and metrics.Registry and the probes of health on port
+func startServer(port int, registry *prometheus.Registry, health healthGroup) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(prometheus.Gatherers{registry, metrics.Registry}, promhttp.HandlerOpts{Registry: registry}))
+	mux.HandleFunc("/healthz", health.healthzHandler)
+	mux.HandleFunc("/readyz", health.readyzHandler)
+	return listen(fmt.Sprintf(":%d", port), mux)
+}
+
+// listen serves handler on address in the background
+func listen(address string, handler http.Handler) *http.Server {
+	server := &http.Server{
+		Addr:    address,
+		Handler: handler,
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			util.Log().Fatal(err)
+		}
+	}()
+	return server
+}
+
+// stopServer waits up to metricsServerShutdownTimeout for open requests, server can be nil
+func stopServer(server *http.Server) {
+	if server == nil {
+		return
+	}
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), metricsServerShutdownTimeout)
+	defer shutdownCancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		util.Log().Errorw("Error while shutting down metrics server", "error", err.Error())
+	}
+}
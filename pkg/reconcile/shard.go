@@ -0,0 +1,78 @@
+package reconcile
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"github.com/app-sre/go-qontract-reconcile/pkg/util"
+)
+
+const (
+	// ShardStrategyHash assigns targets to shards by a stable hash of the target name
+	ShardStrategyHash = "hash"
+	// ShardStrategyKey assigns targets to shards by a stable hash of the key returned by ShardKeyer
+	ShardStrategyKey = "key"
+)
+
+// ShardKeyer can be implemented by Integrations to control which targets end up in the same shard
+type ShardKeyer interface {
+	ShardKey(target string, rs *ResourceState) string
+}
+
+// optionalShardKeyer is implemented by adapters, that implement ShardKeyer only if the integration they wrap does
+type optionalShardKeyer interface {
+	isShardKeyer() bool
+}
+
+// shardFor returns the shard a key belongs to
+func shardFor(key string, shards int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(shards))
+}
+
+// shardedName returns name with the shard appended if targets are sharded, it keys state kept per shard
+func shardedName(name string, config *runnerConfig) string {
+	if config.Shards > 1 {
+		return fmt.Sprintf("%s-shard-%d", name, config.ShardID)
+	}
+	return name
+}
+
+// filterShard removes all targets from the ResourceInventory, that do not belong to the configured shard
+func (i *IntegrationRunner) filterShard(ri *ResourceInventory) error {
+	if i.config.Shards <= 1 {
+		return nil
+	}
+	if i.config.ShardID < 0 || i.config.ShardID >= i.config.Shards {
+		return fmt.Errorf("shard id %d out of range for %d shards", i.config.ShardID, i.config.Shards)
+	}
+
+	var keyer ShardKeyer
+	switch i.config.ShardStrategy {
+	case ShardStrategyHash, "":
+	case ShardStrategyKey:
+		k, ok := i.Runnable.(ShardKeyer)
+		if optional, isOptional := i.Runnable.(optionalShardKeyer); isOptional && !optional.isShardKeyer() {
+			ok = false
+		}
+		if !ok {
+			return fmt.Errorf("shard strategy %s requires integration %s to implement ShardKeyer", ShardStrategyKey, i.Name)
+		}
+		keyer = k
+	default:
+		return fmt.Errorf("unknown shard strategy %s", i.config.ShardStrategy)
+	}
+
+	for target, rs := range ri.State {
+		key := target
+		if keyer != nil {
+			key = keyer.ShardKey(target, rs)
+		}
+		if shardFor(key, i.config.Shards) != i.config.ShardID {
+			delete(ri.State, target)
+		}
+	}
+	util.Log().Debugw("Filtered targets for shard", "shard", i.config.ShardID, "shards", i.config.Shards, "targets", len(ri.State))
+	return nil
+}
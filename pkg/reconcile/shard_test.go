@@ -0,0 +1,86 @@
+package reconcile
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type TestShardIntegration struct {
+	TestIntegration
+}
+
+// ShardKey groups targets by their prefix
+func (e *TestShardIntegration) ShardKey(target string, _ *ResourceState) string {
+	return strings.Split(target, "/")[0]
+}
+
+func newShardTestInventory() *ResourceInventory {
+	ri := NewResourceInventory()
+	for i := 0; i < 100; i++ {
+		ri.AddResourceState(fmt.Sprintf("group-%d/project-%d", i%10, i), &ResourceState{})
+	}
+	return ri
+}
+
+func TestFilterShardSplitsTargets(t *testing.T) {
+	seen := map[string]int{}
+	for shard := 0; shard < 3; shard++ {
+		runner := IntegrationRunner{
+			Runnable: NewTestIntegration(throwErrorSettings{}),
+			config:   &runnerConfig{Shards: 3, ShardID: shard, ShardStrategy: ShardStrategyHash},
+		}
+		ri := newShardTestInventory()
+		assert.NoError(t, runner.filterShard(ri))
+		assert.NotEmpty(t, ri.State)
+		for target := range ri.State {
+			seen[target]++
+		}
+	}
+	assert.Len(t, seen, 100)
+	for _, count := range seen {
+		assert.Equal(t, 1, count)
+	}
+}
+
+func TestFilterShardByKey(t *testing.T) {
+	runner := IntegrationRunner{
+		Runnable: &TestShardIntegration{},
+		config:   &runnerConfig{Shards: 3, ShardID: 1, ShardStrategy: ShardStrategyKey},
+	}
+	ri := newShardTestInventory()
+	assert.NoError(t, runner.filterShard(ri))
+
+	groups := map[string]bool{}
+	for target := range ri.State {
+		groups[strings.Split(target, "/")[0]] = true
+	}
+	// every group has 10 projects, all of them must be in the same shard
+	assert.Len(t, ri.State, len(groups)*10)
+}
+
+func TestFilterShardErrors(t *testing.T) {
+	for _, config := range []*runnerConfig{
+		{Shards: 2, ShardID: 2},
+		{Shards: 2, ShardID: 0, ShardStrategy: "unknown"},
+		{Shards: 2, ShardID: 0, ShardStrategy: ShardStrategyKey},
+	} {
+		runner := IntegrationRunner{
+			Runnable: NewTestIntegration(throwErrorSettings{}),
+			config:   config,
+		}
+		assert.Error(t, runner.filterShard(newShardTestInventory()))
+	}
+}
+
+func TestFilterShardDisabled(t *testing.T) {
+	runner := IntegrationRunner{
+		Runnable: NewTestIntegration(throwErrorSettings{}),
+		config:   &runnerConfig{Shards: 1},
+	}
+	ri := newShardTestInventory()
+	assert.NoError(t, runner.filterShard(ri))
+	assert.Len(t, ri.State, 100)
+}
@@ -0,0 +1,57 @@
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/app-sre/go-qontract-reconcile/pkg/util"
+)
+
+// TargetErrors aggregates the errors of all failed targets of a ResourceInventory
+type TargetErrors struct {
+	Errors map[string]error
+}
+
+// Error lists all failed targets with their error, sorted by target
+func (e *TargetErrors) Error() string {
+	targets := make([]string, 0, len(e.Errors))
+	for target := range e.Errors {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	messages := make([]string, 0, len(targets))
+	for _, target := range targets {
+		messages = append(messages, fmt.Sprintf("%s: %s", target, e.Errors[target].Error()))
+	}
+	return fmt.Sprintf("%d target(s) failed: %s", len(targets), strings.Join(messages, "; "))
+}
+
+// ForEachTarget runs f for every target of state, sorted by target. Failing targets do not stop
+// the remaining ones, their errors are returned as TargetErrors. If ctx is done, the remaining
+// targets are skipped and marked as failed with the cause of ctx, i.e. a lost leader lease. S is ResourceState or TypedResourceState.
+func ForEachTarget[S any](ctx context.Context, state map[string]*S, f func(context.Context, string, *S) error) error {
+	targets := make([]string, 0, len(state))
+	for target := range state {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	targetErrors := &TargetErrors{Errors: map[string]error{}}
+	for _, target := range targets {
+		if ctx.Err() != nil {
+			targetErrors.Errors[target] = context.Cause(ctx)
+			continue
+		}
+		if err := f(ctx, target, state[target]); err != nil {
+			util.Log().Errorw("Error while reconciling target", "target", target, "error", err.Error())
+			targetErrors.Errors[target] = err
+		}
+	}
+	if len(targetErrors.Errors) > 0 {
+		return targetErrors
+	}
+	return nil
+}
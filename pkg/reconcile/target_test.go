@@ -0,0 +1,89 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForEachTargetContinuesOnError(t *testing.T) {
+	ri := NewResourceInventory()
+	ri.AddResourceState("a", &ResourceState{})
+	ri.AddResourceState("b", &ResourceState{})
+	ri.AddResourceState("c", &ResourceState{})
+
+	visited := []string{}
+	err := ForEachTarget(context.Background(), ri.State, func(_ context.Context, target string, _ *ResourceState) error {
+		visited = append(visited, target)
+		if target == "a" || target == "c" {
+			return errors.New("broken")
+		}
+		return nil
+	})
+
+	assert.Equal(t, []string{"a", "b", "c"}, visited)
+	var targetErrors *TargetErrors
+	assert.True(t, errors.As(err, &targetErrors))
+	assert.Len(t, targetErrors.Errors, 2)
+	assert.Equal(t, "2 target(s) failed: a: broken; c: broken", err.Error())
+}
+
+func TestForEachTargetOkay(t *testing.T) {
+	ri := NewTypedResourceInventory[string, string, string]()
+	ri.AddResourceState("a", &TypedResourceState[string, string, string]{Desired: "a"})
+
+	err := ForEachTarget(context.Background(), ri.State, func(_ context.Context, target string, rs *TypedResourceState[string, string, string]) error {
+		assert.Equal(t, target, rs.Desired)
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestForEachTargetCanceled(t *testing.T) {
+	ri := NewResourceInventory()
+	ri.AddResourceState("a", &ResourceState{})
+	ri.AddResourceState("b", &ResourceState{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := ForEachTarget(ctx, ri.State, func(_ context.Context, _ string, _ *ResourceState) error {
+		cancel()
+		return nil
+	})
+
+	var targetErrors *TargetErrors
+	assert.True(t, errors.As(err, &targetErrors))
+	assert.Equal(t, context.Canceled, targetErrors.Errors["b"])
+	assert.NotContains(t, targetErrors.Errors, "a")
+}
+
+type TestFailingTargetsIntegration struct {
+	TestIntegration
+}
+
+func (e *TestFailingTargetsIntegration) CurrentState(_ context.Context, ri *ResourceInventory) error {
+	ri.AddResourceState("a", &ResourceState{})
+	ri.AddResourceState("b", &ResourceState{})
+	return nil
+}
+
+func (e *TestFailingTargetsIntegration) Reconcile(ctx context.Context, ri *ResourceInventory) error {
+	return ForEachTarget(ctx, ri.State, func(_ context.Context, _ string, _ *ResourceState) error {
+		return errors.New("broken")
+	})
+}
+
+func TestIntegrationRunnerFailedTargetsMetric(t *testing.T) {
+	runner := IntegrationRunner{
+		Runnable: &TestFailingTargetsIntegration{},
+		Name:     "test",
+		config:   &runnerConfig{},
+		metrics:  newIntegrationRunnerMetrics(prometheus.NewRegistry(), "test"),
+	}
+	err := runner.runIntegration(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, float64(2), testutil.ToFloat64(runner.metrics.failedTargets))
+}
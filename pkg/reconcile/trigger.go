@@ -0,0 +1,184 @@
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/app-sre/go-qontract-reconcile/pkg/util"
+)
+
+const (
+	// TriggerModeInterval starts a run every SleepDurationSecs
+	TriggerModeInterval = "interval"
+	// TriggerModeBundle starts a run as soon as the bundle SHA served by qontract-server changes
+	TriggerModeBundle = "bundle"
+)
+
+const (
+	triggerReasonInterval = "interval"
+	triggerReasonBundle   = "bundle"
+	triggerReasonMaxIdle  = "max_idle"
+	triggerReasonManual   = "manual"
+	triggerReasonBackoff  = "backoff"
+)
+
+// BundleShaGetter returns the SHA of the bundle currently served by qontract-server, it is implemented by gql.QontractClient
+type BundleShaGetter interface {
+	BundleSha(ctx context.Context) (string, error)
+}
+
+// trigger decides when the next run of an IntegrationRunner starts
+type trigger struct {
+	mode         string
+	sleep        time.Duration
+	pollInterval time.Duration
+	maxIdle      time.Duration
+	bundle       BundleShaGetter
+	lastSha      string
+	manual       chan struct{}
+}
+
+// NeedsBundle reports if the Integration uses Bundle, either for the bundle trigger mode or to record
+// the bundle SHA in its run history. Bundle can stay nil otherwise.
+func (i *IntegrationRunner) NeedsBundle() bool {
+	return i.config.TriggerMode == TriggerModeBundle || i.config.RunHistory > 0
+}
+
+func newTrigger(config *runnerConfig, bundle BundleShaGetter) (*trigger, error) {
+	t := &trigger{
+		mode:         config.TriggerMode,
+		sleep:        time.Duration(config.SleepDurationSecs) * time.Second,
+		pollInterval: time.Duration(config.BundlePollSecs) * time.Second,
+		maxIdle:      time.Duration(config.MaxIdleSecs) * time.Second,
+		bundle:       bundle,
+		manual:       make(chan struct{}, 1),
+	}
+	switch t.mode {
+	case TriggerModeInterval, "":
+		t.mode = TriggerModeInterval
+	case TriggerModeBundle:
+		if bundle == nil {
+			return nil, fmt.Errorf("trigger mode %s requires a BundleShaGetter", TriggerModeBundle)
+		}
+		if t.pollInterval <= 0 {
+			return nil, fmt.Errorf("bundle poll interval must be greater than 0")
+		}
+	default:
+		return nil, fmt.Errorf("unknown trigger mode %s", t.mode)
+	}
+	return t, nil
+}
+
+// beforeRun records the bundle SHA the next run is based on
+func (t *trigger) beforeRun(ctx context.Context) {
+	if t.mode != TriggerModeBundle {
+		return
+	}
+	sha, err := t.bundle.BundleSha(ctx)
+	if err != nil {
+		util.Log().Warnw("Error while getting bundle sha", "error", err.Error())
+		return
+	}
+	t.lastSha = sha
+}
+
+// wait blocks until the next run is due or ctx is done, it returns why the run was triggered
+func (t *trigger) wait(ctx context.Context) string {
+	var idle <-chan time.Time
+	idleReason := triggerReasonInterval
+	var poll <-chan time.Time
+	if t.mode == TriggerModeBundle {
+		idleReason = triggerReasonMaxIdle
+		ticker := time.NewTicker(t.pollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+		if t.maxIdle > 0 {
+			timer := time.NewTimer(t.maxIdle)
+			defer timer.Stop()
+			idle = timer.C
+		}
+	} else {
+		timer := time.NewTimer(t.sleep)
+		defer timer.Stop()
+		idle = timer.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ""
+		case <-idle:
+			return idleReason
+		case <-t.manual:
+			return triggerReasonManual
+		case <-poll:
+			if t.bundleChanged(ctx) {
+				return triggerReasonBundle
+			}
+		}
+	}
+}
+
+// waitBackoff blocks for delay after a failed run or until ctx is done, a manual trigger ends it early
+func (t *trigger) waitBackoff(ctx context.Context, delay time.Duration) string {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ""
+	case <-timer.C:
+		return triggerReasonBackoff
+	case <-t.manual:
+		return triggerReasonManual
+	}
+}
+
+func (t *trigger) bundleChanged(ctx context.Context) bool {
+	sha, err := t.bundle.BundleSha(ctx)
+	if err != nil {
+		util.Log().Warnw("Error while polling bundle sha", "error", err.Error())
+		return false
+	}
+	return sha != t.lastSha
+}
+
+// fire starts the next run immediately, triggers during a run start the next run right after it
+func (t *trigger) fire() {
+	select {
+	case t.manual <- struct{}{}:
+	default:
+	}
+}
+
+// triggerHandler fires all triggers on POST requests
+func triggerHandler(triggers ...*trigger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		for _, t := range triggers {
+			t.fire()
+		}
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintln(w, "run triggered")
+	}
+}
+
+// startTriggerServer serves /trigger for all runners and /trigger/<name> for every single runner on address,
+// it returns nil if address is empty
+func startTriggerServer(address string, runners ...*IntegrationRunner) *http.Server {
+	if address == "" {
+		return nil
+	}
+	mux := http.NewServeMux()
+	all := []*trigger{}
+	for _, r := range runners {
+		all = append(all, r.trigger)
+		mux.HandleFunc("/trigger/"+r.Name, triggerHandler(r.trigger))
+	}
+	mux.HandleFunc("/trigger", triggerHandler(all...))
+	return listen(address, mux)
+}
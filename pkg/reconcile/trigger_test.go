@@ -0,0 +1,117 @@
+package reconcile
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeBundle struct {
+	mu  sync.Mutex
+	sha string
+}
+
+func (b *fakeBundle) BundleSha(context.Context) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.sha, nil
+}
+
+func (b *fakeBundle) set(sha string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sha = sha
+}
+
+func newTestTrigger(mode string, bundle BundleShaGetter) *trigger {
+	return &trigger{
+		mode:         mode,
+		sleep:        10 * time.Millisecond,
+		pollInterval: 5 * time.Millisecond,
+		bundle:       bundle,
+		manual:       make(chan struct{}, 1),
+	}
+}
+
+func TestNewTrigger(t *testing.T) {
+	_, err := newTrigger(&runnerConfig{TriggerMode: TriggerModeBundle, BundlePollSecs: 10}, nil)
+	assert.ErrorContains(t, err, "requires a BundleShaGetter")
+
+	_, err = newTrigger(&runnerConfig{TriggerMode: "cron"}, nil)
+	assert.ErrorContains(t, err, "unknown trigger mode cron")
+
+	tr, err := newTrigger(&runnerConfig{}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, TriggerModeInterval, tr.mode)
+}
+
+func TestNeedsBundle(t *testing.T) {
+	newRunner := func(config *runnerConfig) *IntegrationRunner {
+		return newIntegrationRunner(NewTestIntegration(throwErrorSettings{}), "test", config, prometheus.NewRegistry())
+	}
+	assert.False(t, newRunner(&runnerConfig{}).NeedsBundle())
+	assert.True(t, newRunner(&runnerConfig{RunHistory: 10}).NeedsBundle())
+
+	d := &Daemon{runners: []*IntegrationRunner{newRunner(&runnerConfig{})}}
+	assert.False(t, d.NeedsBundle())
+	d.runners = append(d.runners, newRunner(&runnerConfig{TriggerMode: TriggerModeBundle}))
+	assert.True(t, d.NeedsBundle())
+}
+
+func TestTriggerInterval(t *testing.T) {
+	tr := newTestTrigger(TriggerModeInterval, nil)
+	assert.Equal(t, triggerReasonInterval, tr.wait(context.Background()))
+}
+
+func TestTriggerBundleChanged(t *testing.T) {
+	bundle := &fakeBundle{sha: "a"}
+	tr := newTestTrigger(TriggerModeBundle, bundle)
+	tr.beforeRun(context.Background())
+	assert.Equal(t, "a", tr.lastSha)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		bundle.set("b")
+	}()
+	assert.Equal(t, triggerReasonBundle, tr.wait(context.Background()))
+}
+
+func TestTriggerMaxIdle(t *testing.T) {
+	tr := newTestTrigger(TriggerModeBundle, &fakeBundle{sha: "a"})
+	tr.maxIdle = 20 * time.Millisecond
+	tr.beforeRun(context.Background())
+	assert.Equal(t, triggerReasonMaxIdle, tr.wait(context.Background()))
+}
+
+func TestTriggerCanceled(t *testing.T) {
+	tr := newTestTrigger(TriggerModeBundle, &fakeBundle{sha: "a"})
+	tr.beforeRun(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, "", tr.wait(ctx))
+}
+
+func TestTriggerHandler(t *testing.T) {
+	tr := newTestTrigger(TriggerModeBundle, &fakeBundle{sha: "a"})
+	tr.beforeRun(context.Background())
+	handler := triggerHandler(tr)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/trigger", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/trigger", nil))
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	// A second trigger before the next run is merged into the first one
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/trigger", nil))
+
+	assert.Equal(t, triggerReasonManual, tr.wait(context.Background()))
+	assert.Len(t, tr.manual, 0)
+}
@@ -0,0 +1,299 @@
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/app-sre/go-qontract-reconcile/pkg/util"
+)
+
+// TypedIntegration is the type-safe variant of Integration. C is the type of the
+// configuration, Cur of the current and Des of the desired state of a target.
+type TypedIntegration[C, Cur, Des any] interface {
+	CurrentState(context.Context, *TypedResourceInventory[C, Cur, Des]) error
+	DesiredState(context.Context, *TypedResourceInventory[C, Cur, Des]) error
+	Reconcile(context.Context, *TypedResourceInventory[C, Cur, Des]) error
+	LogDiff(*TypedResourceInventory[C, Cur, Des])
+	Setup(context.Context) error
+}
+
+// TypedPlanner is the type-safe variant of Planner
+type TypedPlanner[C, Cur, Des any] interface {
+	Plan(*TypedResourceInventory[C, Cur, Des], *Plan)
+}
+
+// TypedShardKeyer is the type-safe variant of ShardKeyer
+type TypedShardKeyer[C, Cur, Des any] interface {
+	ShardKey(target string, rs *TypedResourceState[C, Cur, Des]) string
+}
+
+// TypedDeletionCounter is the type-safe variant of DeletionCounter
+type TypedDeletionCounter[C, Cur, Des any] interface {
+	PlannedDeletions(ri *TypedResourceInventory[C, Cur, Des], plan *Plan) int
+}
+
+// TypedPostReconciler is the type-safe variant of PostReconciler
+type TypedPostReconciler[C, Cur, Des any] interface {
+	PostReconcile(ctx context.Context, ri *TypedResourceInventory[C, Cur, Des], err error) error
+}
+
+// TypedPlanValidator is the type-safe variant of PlanValidator
+type TypedPlanValidator[C, Cur, Des any] interface {
+	Validate(ctx context.Context, ri *TypedResourceInventory[C, Cur, Des]) error
+}
+
+// TypedResourceInventory is the type-safe variant of ResourceInventory
+type TypedResourceInventory[C, Cur, Des any] struct {
+	State map[string]*TypedResourceState[C, Cur, Des]
+}
+
+// NewTypedResourceInventory creates a new TypedResourceInventory
+func NewTypedResourceInventory[C, Cur, Des any]() *TypedResourceInventory[C, Cur, Des] {
+	return &TypedResourceInventory[C, Cur, Des]{
+		State: map[string]*TypedResourceState[C, Cur, Des]{},
+	}
+}
+
+// AddResourceState adds a TypedResourceState to the TypedResourceInventory
+func (ri *TypedResourceInventory[C, Cur, Des]) AddResourceState(target string, rs *TypedResourceState[C, Cur, Des]) {
+	ri.State[target] = rs
+}
+
+// GetResourceState returns a TypedResourceState from the TypedResourceInventory
+func (ri *TypedResourceInventory[C, Cur, Des]) GetResourceState(target string) *TypedResourceState[C, Cur, Des] {
+	return ri.State[target]
+}
+
+// TypedResourceState is the type-safe variant of ResourceState. Current or Desired set to the zero value of their type
+// are unset, i.e. a target without Current is created. Use pointer types if the zero value is a valid state.
+type TypedResourceState[C, Cur, Des any] struct {
+	// Config is the configuration of the resource, usually the GraphQL response object
+	Config C
+	// Current state of the resource
+	Current Cur
+	// Desired state of the resource
+	Desired Des
+}
+
+// writeTo replaces the content of ri with the content of the TypedResourceInventory
+func (ri *TypedResourceInventory[C, Cur, Des]) writeTo(untyped *ResourceInventory) {
+	untyped.State = make(map[string]*ResourceState, len(ri.State))
+	for target, rs := range ri.State {
+		untyped.AddResourceState(target, &ResourceState{
+			Config:  rs.Config,
+			Current: untypedState(rs.Current),
+			Desired: untypedState(rs.Desired),
+		})
+	}
+}
+
+// untypedState returns nil for the zero value, so unset typed states stay nil in the ResourceInventory
+func untypedState[T any](value T) interface{} {
+	if reflect.ValueOf(&value).Elem().IsZero() {
+		return nil
+	}
+	return value
+}
+
+// newTypedResourceInventoryFrom converts a ResourceInventory, returns an error instead of panicing on type mismatches
+func newTypedResourceInventoryFrom[C, Cur, Des any](untyped *ResourceInventory) (*TypedResourceInventory[C, Cur, Des], error) {
+	ri := NewTypedResourceInventory[C, Cur, Des]()
+	for target, rs := range untyped.State {
+		typed, err := newTypedResourceStateFrom[C, Cur, Des](target, rs)
+		if err != nil {
+			return nil, err
+		}
+		ri.AddResourceState(target, typed)
+	}
+	return ri, nil
+}
+
+func newTypedResourceStateFrom[C, Cur, Des any](target string, rs *ResourceState) (*TypedResourceState[C, Cur, Des], error) {
+	config, err := assertStateType[C](target, "Config", rs.Config)
+	if err != nil {
+		return nil, err
+	}
+	current, err := assertStateType[Cur](target, "Current", rs.Current)
+	if err != nil {
+		return nil, err
+	}
+	desired, err := assertStateType[Des](target, "Desired", rs.Desired)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedResourceState[C, Cur, Des]{
+		Config:  config,
+		Current: current,
+		Desired: desired,
+	}, nil
+}
+
+func assertStateType[T any](target, field string, value interface{}) (T, error) {
+	var typed T
+	if value == nil {
+		return typed, nil
+	}
+	typed, ok := value.(T)
+	if !ok {
+		return typed, fmt.Errorf("unexpected type %T for %s of target %s", value, field, target)
+	}
+	return typed, nil
+}
+
+// typedIntegrationAdapter implements Integration for a TypedIntegration
+type typedIntegrationAdapter[C, Cur, Des any] struct {
+	runnable TypedIntegration[C, Cur, Des]
+}
+
+var _ Integration = &typedIntegrationAdapter[any, any, any]{}
+var _ Planner = &typedIntegrationAdapter[any, any, any]{}
+var _ ShardKeyer = &typedIntegrationAdapter[any, any, any]{}
+var _ DeletionCounter = &typedIntegrationAdapter[any, any, any]{}
+var _ fallibleDeletionCounter = &typedIntegrationAdapter[any, any, any]{}
+var _ Teardowner = &typedIntegrationAdapter[any, any, any]{}
+var _ PostReconciler = &typedIntegrationAdapter[any, any, any]{}
+var _ PlanValidator = &typedIntegrationAdapter[any, any, any]{}
+
+// AdaptTypedIntegration wraps a TypedIntegration, so it can be used everywhere an Integration is expected
+func AdaptTypedIntegration[C, Cur, Des any](runnable TypedIntegration[C, Cur, Des]) Integration {
+	return &typedIntegrationAdapter[C, Cur, Des]{
+		runnable: runnable,
+	}
+}
+
+// NewTypedIntegrationRunner creates a IntegrationRunner for a given TypedIntegration
+func NewTypedIntegrationRunner[C, Cur, Des any](runnable TypedIntegration[C, Cur, Des], name string) *IntegrationRunner {
+	return NewIntegrationRunner(AdaptTypedIntegration(runnable), name)
+}
+
+func (a *typedIntegrationAdapter[C, Cur, Des]) run(ri *ResourceInventory, phase func(*TypedResourceInventory[C, Cur, Des]) error) error {
+	typed, err := newTypedResourceInventoryFrom[C, Cur, Des](ri)
+	if err != nil {
+		return err
+	}
+	err = phase(typed)
+	typed.writeTo(ri)
+	return err
+}
+
+func (a *typedIntegrationAdapter[C, Cur, Des]) Setup(ctx context.Context) error {
+	return a.runnable.Setup(ctx)
+}
+
+func (a *typedIntegrationAdapter[C, Cur, Des]) CurrentState(ctx context.Context, ri *ResourceInventory) error {
+	return a.run(ri, func(typed *TypedResourceInventory[C, Cur, Des]) error {
+		return a.runnable.CurrentState(ctx, typed)
+	})
+}
+
+func (a *typedIntegrationAdapter[C, Cur, Des]) DesiredState(ctx context.Context, ri *ResourceInventory) error {
+	return a.run(ri, func(typed *TypedResourceInventory[C, Cur, Des]) error {
+		return a.runnable.DesiredState(ctx, typed)
+	})
+}
+
+func (a *typedIntegrationAdapter[C, Cur, Des]) Reconcile(ctx context.Context, ri *ResourceInventory) error {
+	return a.run(ri, func(typed *TypedResourceInventory[C, Cur, Des]) error {
+		return a.runnable.Reconcile(ctx, typed)
+	})
+}
+
+func (a *typedIntegrationAdapter[C, Cur, Des]) LogDiff(ri *ResourceInventory) {
+	err := a.run(ri, func(typed *TypedResourceInventory[C, Cur, Des]) error {
+		a.runnable.LogDiff(typed)
+		return nil
+	})
+	if err != nil {
+		util.Log().Errorw("Error during LogDiff", "error", err.Error())
+	}
+}
+
+func (a *typedIntegrationAdapter[C, Cur, Des]) Plan(ri *ResourceInventory, plan *Plan) {
+	planner, ok := a.runnable.(TypedPlanner[C, Cur, Des])
+	if !ok {
+		derivePlan(ri, plan)
+		return
+	}
+	err := a.run(ri, func(typed *TypedResourceInventory[C, Cur, Des]) error {
+		planner.Plan(typed, plan)
+		return nil
+	})
+	if err != nil {
+		util.Log().Errorw("Error during Plan", "error", err.Error())
+	}
+}
+
+// isShardKeyer reports if the wrapped integration is a TypedShardKeyer
+func (a *typedIntegrationAdapter[C, Cur, Des]) isShardKeyer() bool {
+	_, ok := a.runnable.(TypedShardKeyer[C, Cur, Des])
+	return ok
+}
+
+// ShardKey uses the key of a TypedShardKeyer and falls back to the target name
+func (a *typedIntegrationAdapter[C, Cur, Des]) ShardKey(target string, rs *ResourceState) string {
+	keyer, ok := a.runnable.(TypedShardKeyer[C, Cur, Des])
+	if !ok {
+		return target
+	}
+	typed, err := newTypedResourceStateFrom[C, Cur, Des](target, rs)
+	if err != nil {
+		util.Log().Errorw("Error during ShardKey", "error", err.Error())
+		return target
+	}
+	return keyer.ShardKey(target, typed)
+}
+
+// PlannedDeletions uses the count of a TypedDeletionCounter and falls back to the ActionDelete entries of plan
+func (a *typedIntegrationAdapter[C, Cur, Des]) PlannedDeletions(ri *ResourceInventory, plan *Plan) int {
+	deletions, err := a.countDeletions(ri, plan)
+	if err != nil {
+		util.Log().Errorw("Error during PlannedDeletions", "error", err.Error())
+	}
+	return deletions
+}
+
+// countDeletions is PlannedDeletions, but returns an error if ri can not be converted
+func (a *typedIntegrationAdapter[C, Cur, Des]) countDeletions(ri *ResourceInventory, plan *Plan) (int, error) {
+	counter, ok := a.runnable.(TypedDeletionCounter[C, Cur, Des])
+	if !ok {
+		return plan.Count(ActionDelete), nil
+	}
+	deletions := 0
+	err := a.run(ri, func(typed *TypedResourceInventory[C, Cur, Des]) error {
+		deletions = counter.PlannedDeletions(typed, plan)
+		return nil
+	})
+	return deletions, err
+}
+
+// Teardown uses Teardown of a Teardowner and does nothing otherwise
+func (a *typedIntegrationAdapter[C, Cur, Des]) Teardown(ctx context.Context) error {
+	teardowner, ok := a.runnable.(Teardowner)
+	if !ok {
+		return nil
+	}
+	return teardowner.Teardown(ctx)
+}
+
+// PostReconcile uses PostReconcile of a TypedPostReconciler and does nothing otherwise
+func (a *typedIntegrationAdapter[C, Cur, Des]) PostReconcile(ctx context.Context, ri *ResourceInventory, err error) error {
+	postReconciler, ok := a.runnable.(TypedPostReconciler[C, Cur, Des])
+	if !ok {
+		return nil
+	}
+	return a.run(ri, func(typed *TypedResourceInventory[C, Cur, Des]) error {
+		return postReconciler.PostReconcile(ctx, typed, err)
+	})
+}
+
+// Validate uses Validate of a TypedPlanValidator and does nothing otherwise
+func (a *typedIntegrationAdapter[C, Cur, Des]) Validate(ctx context.Context, ri *ResourceInventory) error {
+	validator, ok := a.runnable.(TypedPlanValidator[C, Cur, Des])
+	if !ok {
+		return nil
+	}
+	return a.run(ri, func(typed *TypedResourceInventory[C, Cur, Des]) error {
+		return validator.Validate(ctx, typed)
+	})
+}
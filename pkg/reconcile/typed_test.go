@@ -0,0 +1,159 @@
+package reconcile
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testConfig struct {
+	Name string
+}
+
+type TestTypedIntegration struct {
+	Reconciled map[string]int
+}
+
+func (e *TestTypedIntegration) Setup(context.Context) error {
+	e.Reconciled = map[string]int{}
+	return nil
+}
+
+func (e *TestTypedIntegration) CurrentState(_ context.Context, ri *TypedResourceInventory[*testConfig, int, int]) error {
+	ri.AddResourceState("a", &TypedResourceState[*testConfig, int, int]{Current: 1})
+	ri.AddResourceState("b", &TypedResourceState[*testConfig, int, int]{Current: 2})
+	return nil
+}
+
+func (e *TestTypedIntegration) DesiredState(_ context.Context, ri *TypedResourceInventory[*testConfig, int, int]) error {
+	for target, state := range ri.State {
+		state.Config = &testConfig{Name: target}
+		state.Desired = state.Current + 1
+	}
+	return nil
+}
+
+func (e *TestTypedIntegration) Reconcile(_ context.Context, ri *TypedResourceInventory[*testConfig, int, int]) error {
+	for _, state := range ri.State {
+		e.Reconciled[state.Config.Name] = state.Desired
+	}
+	return nil
+}
+
+func (e *TestTypedIntegration) LogDiff(*TypedResourceInventory[*testConfig, int, int]) {}
+
+func (e *TestTypedIntegration) Plan(ri *TypedResourceInventory[*testConfig, int, int], plan *Plan) {
+	for target := range ri.State {
+		plan.Add(target, ActionUpdate, "", "")
+	}
+}
+
+var _ TypedIntegration[*testConfig, int, int] = &TestTypedIntegration{}
+
+func TestRunTypedIntegration(t *testing.T) {
+	integration := &TestTypedIntegration{}
+	runner := IntegrationRunner{
+		Runnable: AdaptTypedIntegration[*testConfig, int, int](integration),
+		config:   &runnerConfig{},
+	}
+	err := runner.runIntegration(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"a": 2, "b": 3}, integration.Reconciled)
+
+	plan := NewPlan("test")
+	ri := NewResourceInventory()
+	ri.AddResourceState("a", &ResourceState{Current: 1})
+	runner.Runnable.(Planner).Plan(ri, plan)
+	assert.Equal(t, 1, plan.Count(ActionUpdate))
+}
+
+func TestTypedIntegrationTypeMismatch(t *testing.T) {
+	integration := &TestTypedIntegration{}
+	adapter := AdaptTypedIntegration[*testConfig, int, int](integration)
+	assert.NoError(t, adapter.Setup(context.Background()))
+
+	ri := NewResourceInventory()
+	ri.AddResourceState("a", &ResourceState{Desired: "not an int"})
+
+	err := adapter.Reconcile(context.Background(), ri)
+	assert.ErrorContains(t, err, "unexpected type string for Desired of target a")
+	assert.Empty(t, integration.Reconciled)
+}
+
+// typedCreateDeleteIntegration has a target to create and one to delete, it has no TypedPlanner
+type typedCreateDeleteIntegration struct{}
+
+func (e *typedCreateDeleteIntegration) Setup(context.Context) error { return nil }
+
+func (e *typedCreateDeleteIntegration) CurrentState(_ context.Context, ri *TypedResourceInventory[any, *int, *int]) error {
+	current := 1
+	ri.AddResourceState("delete", &TypedResourceState[any, *int, *int]{Current: &current})
+	return nil
+}
+
+func (e *typedCreateDeleteIntegration) DesiredState(_ context.Context, ri *TypedResourceInventory[any, *int, *int]) error {
+	desired := 2
+	ri.AddResourceState("create", &TypedResourceState[any, *int, *int]{Desired: &desired})
+	return nil
+}
+
+func (e *typedCreateDeleteIntegration) Reconcile(context.Context, *TypedResourceInventory[any, *int, *int]) error {
+	return nil
+}
+
+func (e *typedCreateDeleteIntegration) LogDiff(*TypedResourceInventory[any, *int, *int]) {}
+
+func TestTypedIntegrationDerivedPlan(t *testing.T) {
+	ctx := context.Background()
+	adapter := AdaptTypedIntegration[any, *int, *int](&typedCreateDeleteIntegration{})
+	ri := NewResourceInventory()
+	assert.NoError(t, adapter.CurrentState(ctx, ri))
+	assert.NoError(t, adapter.DesiredState(ctx, ri))
+	assert.Nil(t, ri.GetResourceState("create").Current)
+	assert.Nil(t, ri.GetResourceState("delete").Desired)
+
+	plan := NewPlan("test")
+	adapter.(Planner).Plan(ri, plan)
+	assert.Equal(t, 1, plan.Count(ActionCreate))
+	assert.Equal(t, 1, plan.Count(ActionDelete))
+	assert.Equal(t, 0, plan.Count(ActionUpdate))
+	assert.Equal(t, 1, adapter.(DeletionCounter).PlannedDeletions(ri, plan))
+}
+
+func TestTypedIntegrationShardKeyRequired(t *testing.T) {
+	runner := IntegrationRunner{
+		Name:     "test",
+		Runnable: AdaptTypedIntegration[*testConfig, int, int](&TestTypedIntegration{}),
+		config:   &runnerConfig{Shards: 2, ShardStrategy: ShardStrategyKey},
+	}
+	err := runner.runIntegration(context.Background())
+	assert.EqualError(t, err, "shard strategy key requires integration test to implement ShardKeyer")
+}
+
+// typedCountingIntegration counts one deletion per target
+type typedCountingIntegration struct {
+	TestTypedIntegration
+}
+
+func (e *typedCountingIntegration) PlannedDeletions(ri *TypedResourceInventory[*testConfig, int, int], _ *Plan) int {
+	return len(ri.State)
+}
+
+func TestTypedIntegrationPlannedDeletionsTypeMismatch(t *testing.T) {
+	runner := newTestRunner(t, AdaptTypedIntegration[*testConfig, int, int](&typedCountingIntegration{}))
+	ri := NewResourceInventory()
+	ri.AddResourceState("a", &ResourceState{Desired: "not an int"})
+	summary := &RunSummary{}
+	ctx := withRunSummary(context.Background(), summary)
+
+	_, err := runner.plannedDeletions(ctx, runner.metrics.phases, ri, NewPlan("test"))
+	assert.ErrorContains(t, err, "unexpected type string for Desired of target a")
+	assert.Contains(t, summary.PhaseErrors[phaseDeletionLimit], "unexpected type string")
+
+	ri = NewResourceInventory()
+	ri.AddResourceState("a", &ResourceState{Desired: 1})
+	deletions, err := runner.plannedDeletions(ctx, runner.metrics.phases, ri, NewPlan("test"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deletions)
+}
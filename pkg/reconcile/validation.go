@@ -2,12 +2,20 @@ package reconcile
 
 import (
 	"context"
+	"net/http"
 	"os"
 	"time"
 
+	"github.com/app-sre/go-qontract-reconcile/pkg/metrics"
+	"github.com/app-sre/go-qontract-reconcile/pkg/tracing"
 	"github.com/app-sre/go-qontract-reconcile/pkg/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
 )
 
+// pushTimeout is the maximum time to push the metrics of a validation
+const pushTimeout = 10 * time.Second
+
 // Validation describes the methods an Validation must implement
 type Validation interface {
 	// Setup method is used to fetch secrets, setup clients or prepare state...
@@ -16,11 +24,81 @@ type Validation interface {
 	Validate(context.Context) ([]ValidationError, error)
 }
 
+// Severity of a ValidationError
+type Severity string
+
+const (
+	// SeverityError fails the validation, it is used for ValidationErrors without Severity
+	SeverityError Severity = "error"
+	// SeverityWarning is reported, but does not fail the validation
+	SeverityWarning Severity = "warning"
+	// SeverityInfo is reported, but does not fail the validation
+	SeverityInfo Severity = "info"
+)
+
 // ValidationError contains errors, that are discovered during Validate()
 type ValidationError struct {
 	Path       string
 	Validation string
 	Error      error
+	// Severity defaults to SeverityError
+	Severity Severity
+}
+
+// GetSeverity returns the Severity of the ValidationError, SeverityError if it is not set or unknown
+func (e ValidationError) GetSeverity() Severity {
+	switch e.Severity {
+	case SeverityWarning, SeverityInfo:
+		return e.Severity
+	default:
+		return SeverityError
+	}
+}
+
+// hasErrors returns true if any of validationErrors has SeverityError
+func hasErrors(validationErrors []ValidationError) bool {
+	for _, e := range validationErrors {
+		if e.GetSeverity() == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+type validationRunnerMetrics struct {
+	validationErrors *prometheus.CounterVec
+	phases           *phaseMetrics
+}
+
+func newValidationRunnerMetrics(reg prometheus.Registerer, integration string) *validationRunnerMetrics {
+	labels := prometheus.Labels{"integration": integration}
+
+	m := &validationRunnerMetrics{
+		validationErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "qontract_reconcile_validation_errors_total",
+			Help:        "Number of validation errors found",
+			ConstLabels: labels,
+		}, []string{"validation", "severity"}),
+		phases: newPhaseMetrics(reg, labels),
+	}
+	reg.MustRegister(m.validationErrors)
+	return m
+}
+
+func (m *validationRunnerMetrics) phaseMetrics() *phaseMetrics {
+	if m == nil {
+		return nil
+	}
+	return m.phases
+}
+
+func (m *validationRunnerMetrics) countValidationErrors(validationErrors []ValidationError) {
+	if m == nil {
+		return
+	}
+	for _, e := range validationErrors {
+		m.validationErrors.WithLabelValues(e.Validation, string(e.GetSeverity())).Inc()
+	}
 }
 
 // ValidationRunner is an implementation of Runner
@@ -29,17 +107,23 @@ type ValidationRunner struct {
 	Name     string
 	Exiter   exitFunc
 	config   *runnerConfig
+	metrics  *validationRunnerMetrics
+	registry *prometheus.Registry
 }
 
 // NewValidationRunner creates a ValidationRunner for a given Validation
 func NewValidationRunner(runnable Validation, name string) *ValidationRunner {
 	c := newRunnerConfig()
+	registry := prometheus.NewRegistry()
 	v := &ValidationRunner{
 		Runnable: runnable,
 		Name:     name,
 		config:   c,
+		registry: registry,
+		metrics:  newValidationRunnerMetrics(registry, name),
 	}
 	v.Exiter = func(exitCode int) {
+		tracing.Shutdown(context.Background())
 		os.Exit(exitCode)
 	}
 	return v
@@ -48,6 +132,15 @@ func NewValidationRunner(runnable Validation, name string) *ValidationRunner {
 // Run executes the validation configured as target
 func (v *ValidationRunner) Run() {
 	ctx := context.WithValue(context.Background(), ContextIngetrationNameKey, v.Name)
+	exitCode := v.run(ctx)
+	v.pushMetrics(ctx)
+	if exitCode != 0 {
+		v.Exiter(exitCode)
+	}
+}
+
+// run runs the validation and returns the exit code
+func (v *ValidationRunner) run(ctx context.Context) int {
 	var cancel func()
 	if v.config.Timeout > 0 {
 		ctx, cancel = context.WithTimeout(ctx, time.Duration(v.config.Timeout)*time.Second)
@@ -60,29 +153,64 @@ func (v *ValidationRunner) Run() {
 		enabled, err := isFeatureEnabled(ctx, v.Name)
 		if err != nil {
 			util.Log().Errorw("Error during integration", "error", err.Error())
-			v.Exiter(1)
+			return 1
 		}
 		if !enabled {
 			util.Log().Warnw("Integration not enabled")
-			v.Exiter(0)
+			return 0
 		}
 	}
 
-	if err := v.Runnable.Setup(ctx); err != nil {
+	phases := v.metrics.phaseMetrics()
+	if err := runPhase(ctx, phases, phaseSetup, v.Runnable.Setup); err != nil {
 		util.Log().Errorw("Error during integration", "error", err.Error())
-		v.Exiter(1)
+		return 1
 	}
 
-	validationErrors, err := v.Runnable.Validate(ctx)
+	var validationErrors []ValidationError
+	err := runPhase(ctx, phases, phaseValidate, func(ctx context.Context) error {
+		var err error
+		validationErrors, err = v.Runnable.Validate(ctx)
+		return err
+	})
 	if err != nil {
 		util.Log().Errorw("Error during integration", "error", err.Error())
-		v.Exiter(1)
+		return 1
 	}
-	if len(validationErrors) > 0 {
-		for _, e := range validationErrors {
-			util.Log().Infow("Validation error", "path", e.Path, "validation", e.Validation, "error", e.Error.Error())
-		}
-		v.Exiter(1)
+	all := validationErrors
+	validationErrors, err = v.filterBaseline(validationErrors)
+	if err != nil {
+		util.Log().Errorw("Error while reading validation baseline", "error", err.Error())
+		return 1
+	}
+	v.metrics.countValidationErrors(validationErrors)
+	if err := v.writeReports(validationErrors, all); err != nil {
+		util.Log().Errorw("Error while writing validation reports", "error", err.Error())
+		return 1
+	}
+	for _, e := range validationErrors {
+		util.Log().Infow("Validation error", "path", e.Path, "validation", e.Validation, "severity", e.GetSeverity(), "error", e.Error.Error())
+	}
+	if hasErrors(validationErrors) {
+		return 1
+	}
+	return 0
+}
+
+// pushMetrics pushes the metrics of the run to the configured Pushgateway, validations do not serve metrics as they
+// exit after a single run. Errors are logged and do not fail the validation.
+func (v *ValidationRunner) pushMetrics(ctx context.Context) {
+	if v.config.PushGateway == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, pushTimeout)
+	defer cancel()
+	err := push.New(v.config.PushGateway, v.Name).
+		Client(&http.Client{Transport: tracing.Transport(nil)}).
+		Gatherer(prometheus.Gatherers{v.registry, metrics.Registry}).
+		PushContext(ctx)
+	if err != nil {
+		util.Log().Errorw("Error while pushing metrics", "pushgateway", v.config.PushGateway, "error", err.Error())
 	}
 }
 
@@ -5,6 +5,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"testing"
@@ -149,6 +152,29 @@ func TestValidationRunnerWithValidationErrors(t *testing.T) {
 	assert.Equal(t, "test", structuredOutput["error"])
 }
 
+func TestValidationRunnerPushesMetrics(t *testing.T) {
+	var path, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	t.Setenv("PUSHGATEWAY_URL", server.URL)
+
+	vr := NewValidationRunner(&TestValidation{ReturnValidations: true}, "test")
+	var exitCode int
+	vr.Exiter = func(i int) {
+		exitCode = i
+	}
+	vr.Run()
+	assert.Equal(t, 1, exitCode)
+	assert.Equal(t, "/metrics/job/test", path)
+	assert.Contains(t, body, "qontract_reconcile_validation_errors_total")
+	assert.Contains(t, body, "qontract_reconcile_phase_duration_seconds")
+}
+
 func TestNewRunnerConfig(t *testing.T) {
 	runnerConfg := newRunnerConfig()
 	assert.Equal(t, 0, runnerConfg.Timeout)
@@ -0,0 +1,170 @@
+package state
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/app-sre/go-qontract-reconcile/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/errgroup"
+)
+
+// cacheRequests counts reads of prefetched S3State served from memory (hit) or from S3 (miss)
+var cacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "qontract_reconcile_state_cache_requests_total",
+	Help: "Number of state reads after a prefetch, served from the cache (hit) or from S3 (miss)",
+}, []string{"infix", "result"})
+
+func init() {
+	metrics.Registry.MustRegister(cacheRequests)
+}
+
+// Prefetcher is implemented by Persistence with a read cache
+type Prefetcher interface {
+	// Prefetch reads all keys starting with prefix into the cache
+	Prefetch(context.Context, string) error
+}
+
+// Prefetch reads all keys starting with prefix into the cache of p, it does nothing if p has no cache
+func Prefetch(ctx context.Context, p Persistence, prefix string) error {
+	if prefetcher, ok := p.(Prefetcher); ok {
+		return prefetcher.Prefetch(ctx, prefix)
+	}
+	return nil
+}
+
+// Prefetch lists all keys starting with prefix and gets them in batches of prefetchconcurrency. It enables the cache,
+// Exists and Get are served from memory afterwards and writes go through to S3. Use a new S3State per run.
+func (s *S3State) Prefetch(ctx context.Context, prefix string) error {
+	keys, err := s.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	objects := make([]*cachedObject, len(keys))
+	var g errgroup.Group
+	g.SetLimit(max(1, s.config.PrefetchConcurrency))
+	for i, key := range keys {
+		g.Go(func() error {
+			obj, err := s.getObject(ctx, key)
+			// Keys deleted since listing them are not cached
+			if err != nil && responseStatusCode(err) != http.StatusNotFound {
+				return err
+			}
+			objects[i] = obj
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	s.cache.prefetched(prefix, keys, objects)
+	return nil
+}
+
+type cachedObject struct {
+	body []byte
+	etag string
+}
+
+// s3Cache holds the objects of a S3State, it is disabled until the first prefetch
+type s3Cache struct {
+	mu      sync.Mutex
+	infix   string
+	enabled bool
+	objects map[string]*cachedObject
+	// prefixes were prefetched, keys with one of them that are not in objects do not exist
+	prefixes []string
+	// stale keys failed to be written, it is unknown if they exist
+	stale map[string]bool
+}
+
+func newS3Cache(infix string) *s3Cache {
+	return &s3Cache{
+		infix:   infix,
+		objects: map[string]*cachedObject{},
+		stale:   map[string]bool{},
+	}
+}
+
+func (c *s3Cache) prefetched(prefix string, keys []string, objects []*cachedObject) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.enabled = true
+	c.prefixes = append(c.prefixes, prefix)
+	for i, key := range keys {
+		if objects[i] != nil {
+			c.objects[key] = objects[i]
+			delete(c.stale, key)
+		}
+	}
+}
+
+func (c *s3Cache) count(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheRequests.WithLabelValues(c.infix, result).Inc()
+}
+
+// exists returns if key exists, ok is false if the cache does not know
+func (c *s3Cache) exists(key string) (exists, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.enabled {
+		return false, false
+	}
+	if _, found := c.objects[key]; found {
+		c.count(true)
+		return true, true
+	}
+	if !c.stale[key] {
+		for _, prefix := range c.prefixes {
+			if strings.HasPrefix(key, prefix) {
+				c.count(true)
+				return false, true
+			}
+		}
+	}
+	c.count(false)
+	return false, false
+}
+
+func (c *s3Cache) get(key string) (*cachedObject, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.enabled {
+		return nil, false
+	}
+	obj, ok := c.objects[key]
+	c.count(ok)
+	return obj, ok
+}
+
+func (c *s3Cache) put(key string, body []byte, etag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.enabled {
+		c.objects[key] = &cachedObject{body: body, etag: etag}
+		delete(c.stale, key)
+	}
+}
+
+func (c *s3Cache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.objects, key)
+	delete(c.stale, key)
+}
+
+// invalidate forgets key after a failed write, the next read goes to S3
+func (c *s3Cache) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.enabled {
+		delete(c.objects, key)
+		c.stale[key] = true
+	}
+}
@@ -0,0 +1,129 @@
+package state
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/app-sre/go-qontract-reconcile/pkg/aws/mock"
+	"github.com/app-sre/go-qontract-reconcile/pkg/util"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newGetObjectOutput(body, etag string) *s3.GetObjectOutput {
+	return &s3.GetObjectOutput{
+		Body: io.NopCloser(strings.NewReader(body)),
+		ETag: util.StrPointer(etag),
+	}
+}
+
+func expectPrefetch(mockClient *mock.MockClient) {
+	mockClient.EXPECT().ListObjectsV2(gomock.Any(), gomock.Any()).Return(&s3.ListObjectsV2Output{
+		Contents: []types.Object{
+			{Key: util.StrPointer("state/cache-test/a")},
+			{Key: util.StrPointer("state/cache-test/deleted")},
+		},
+	}, nil)
+	mockClient.EXPECT().GetObject(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, input *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+			if *input.Key == "state/cache-test/deleted" {
+				return nil, newS3ResponseError(http.StatusNotFound)
+			}
+			return newGetObjectOutput(`{"name": "a"}`, `"v1"`), nil
+		}).Times(2)
+}
+
+func TestS3StatePrefetch(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mock.NewMockClient(ctrl)
+	expectPrefetch(mockClient)
+	s := NewS3State("state", "cache-test", mockClient)
+	hits := cacheRequests.WithLabelValues("cache-test", "hit")
+	misses := cacheRequests.WithLabelValues("cache-test", "miss")
+	hitsBefore, missesBefore := testutil.ToFloat64(hits), testutil.ToFloat64(misses)
+
+	assert.NoError(t, Prefetch(ctx, s, ""))
+
+	exists, err := s.Exists(ctx, "a")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = s.Exists(ctx, "deleted")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	var value testValue
+	version, err := s.GetVersioned(ctx, "a", &value)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", value.Name)
+	assert.Equal(t, `"v1"`, version)
+
+	// Writes go through to S3 and update the cache
+	mockClient.EXPECT().PutObject(gomock.Any(), gomock.Any()).Return(&s3.PutObjectOutput{ETag: util.StrPointer(`"v2"`)}, nil)
+	assert.NoError(t, s.Add(ctx, "b", testValue{Name: "b"}))
+	version, err = s.GetVersioned(ctx, "b", &value)
+	assert.NoError(t, err)
+	assert.Equal(t, "b", value.Name)
+	assert.Equal(t, `"v2"`, version)
+
+	mockClient.EXPECT().DeleteObject(gomock.Any(), gomock.Any()).Return(&s3.DeleteObjectOutput{}, nil)
+	assert.NoError(t, s.Rm(ctx, "a"))
+	exists, err = s.Exists(ctx, "a")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	assert.Equal(t, hitsBefore+5, testutil.ToFloat64(hits))
+	assert.Equal(t, missesBefore, testutil.ToFloat64(misses))
+}
+
+func TestS3StateCacheInvalidation(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mock.NewMockClient(ctrl)
+	expectPrefetch(mockClient)
+	s := NewS3State("state", "cache-test", mockClient)
+	assert.NoError(t, s.Prefetch(ctx, ""))
+
+	// A failed conditional write makes the next reads go to S3
+	mockClient.EXPECT().PutObject(gomock.Any(), gomock.Any()).Return(nil, newS3ResponseError(http.StatusPreconditionFailed))
+	_, err := s.AddIfVersion(ctx, "deleted", testValue{Name: "b"}, "")
+	assert.True(t, IsConflict(err))
+
+	mockClient.EXPECT().HeadObject(gomock.Any(), gomock.Any()).Return(&s3.HeadObjectOutput{}, nil)
+	exists, err := s.Exists(ctx, "deleted")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	mockClient.EXPECT().GetObject(gomock.Any(), gomock.Any()).Return(newGetObjectOutput(`{"name": "c"}`, `"v3"`), nil)
+	var value testValue
+	assert.NoError(t, s.Get(ctx, "deleted", &value))
+	assert.Equal(t, "c", value.Name)
+	assert.NoError(t, s.Get(ctx, "deleted", &value))
+}
+
+func TestS3StateWithoutPrefetch(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mock.NewMockClient(ctrl)
+	s := NewS3State("state", "cache-test", mockClient)
+
+	mockClient.EXPECT().GetObject(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(context.Context, *s3.GetObjectInput, ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+			return newGetObjectOutput(`{"name": "a"}`, `"v1"`), nil
+		}).Times(2)
+	var value testValue
+	assert.NoError(t, s.Get(ctx, "a", &value))
+	assert.NoError(t, s.Get(ctx, "a", &value))
+
+	// Persistence without cache ignores prefetches
+	fs, _ := newTestFilesystemState(t)
+	assert.NoError(t, Prefetch(ctx, fs, ""))
+}
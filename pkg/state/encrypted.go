@@ -0,0 +1,208 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/app-sre/go-qontract-reconcile/pkg/util"
+	"github.com/app-sre/go-qontract-reconcile/pkg/vault"
+	"github.com/spf13/viper"
+)
+
+var _ Persistence = &EncryptedState{}
+
+// EncryptedState wraps a Persistence and encrypts all values with age before they are stored.
+// Values are encrypted with the first identity, all identities are used to decrypt, so keys can be rotated.
+// Values that were stored unencrypted are still read.
+type EncryptedState struct {
+	Persistence
+	identities []age.Identity
+	recipient  age.Recipient
+}
+
+// encryptedValue is stored instead of the JSON of a value, Age is the armored ciphertext of the JSON
+type encryptedValue struct {
+	Age string `json:"age"`
+}
+
+type encryptionConfig struct {
+	VaultPath string
+}
+
+func newEncryptionConfig() *encryptionConfig {
+	var ec encryptionConfig
+	sub := util.EnsureViperSub(viper.GetViper(), "state_encryption")
+	sub.BindEnv("vaultpath", "STATE_ENCRYPTION_VAULT_PATH")
+	if err := sub.Unmarshal(&ec); err != nil {
+		util.Log().Fatalw("Error while unmarshalling configuration %s", err.Error())
+	}
+	return &ec
+}
+
+// NewEncryptedState creates a new EncryptedState, identities[0] is used to encrypt values
+func NewEncryptedState(p Persistence, identities []*age.X25519Identity) (*EncryptedState, error) {
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("no age identity to encrypt state with")
+	}
+	e := &EncryptedState{
+		Persistence: p,
+		recipient:   identities[0].Recipient(),
+	}
+	for _, identity := range identities {
+		e.identities = append(e.identities, identity)
+	}
+	return e, nil
+}
+
+// WithEncryption wraps p in an EncryptedState if state_encryption is configured. The identities are read from the
+// field identities of the configured Vault secret, one identity per line, starting with the current one.
+func WithEncryption(ctx context.Context, p Persistence, vc *vault.Client) (Persistence, error) {
+	config := newEncryptionConfig()
+	if config.VaultPath == "" {
+		return p, nil
+	}
+	secret, err := vc.WithContext(ctx).ReadSecret(config.VaultPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading state encryption keys: %w", err)
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("state encryption keys not found in vault path: %s", config.VaultPath)
+	}
+	encoded, ok := secret.Data["identities"].(string)
+	if !ok {
+		return nil, fmt.Errorf("vault secret %s has no field identities", config.VaultPath)
+	}
+	identities, err := parseIdentities(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return NewEncryptedState(p, identities)
+}
+
+// parseIdentities parses age X25519 identities in the format of age key files
+func parseIdentities(encoded string) ([]*age.X25519Identity, error) {
+	parsed, err := age.ParseIdentities(strings.NewReader(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing state encryption keys: %w", err)
+	}
+	identities := []*age.X25519Identity{}
+	for _, identity := range parsed {
+		x25519, ok := identity.(*age.X25519Identity)
+		if !ok {
+			return nil, fmt.Errorf("unsupported state encryption key type %T", identity)
+		}
+		identities = append(identities, x25519)
+	}
+	return identities, nil
+}
+
+func (e *EncryptedState) encrypt(value interface{}) (*encryptedValue, error) {
+	plain, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	armored := armor.NewWriter(&buf)
+	w, err := age.Encrypt(armored, e.recipient)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(plain); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if err := armored.Close(); err != nil {
+		return nil, err
+	}
+	return &encryptedValue{Age: buf.String()}, nil
+}
+
+// decrypt decodes raw into value, raw is either an encryptedValue or the plain JSON of legacy values
+func (e *EncryptedState) decrypt(key string, raw json.RawMessage, value interface{}) error {
+	var encrypted encryptedValue
+	if err := json.Unmarshal(raw, &encrypted); err != nil || !strings.HasPrefix(encrypted.Age, armor.Header) {
+		util.Log().Debugw("Reading unencrypted state", "key", key)
+		return json.Unmarshal(raw, value)
+	}
+	r, err := age.Decrypt(armor.NewReader(strings.NewReader(encrypted.Age)), e.identities...)
+	if err != nil {
+		return fmt.Errorf("error decrypting state %s: %w", key, err)
+	}
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("error decrypting state %s: %w", key, err)
+	}
+	return json.Unmarshal(plain, value)
+}
+
+// Add encrypts value and adds it to the wrapped Persistence
+func (e *EncryptedState) Add(ctx context.Context, key string, value interface{}) error {
+	encrypted, err := e.encrypt(value)
+	if err != nil {
+		return err
+	}
+	return e.Persistence.Add(ctx, key, encrypted)
+}
+
+// AddIfVersion encrypts value and adds it to the wrapped Persistence if its version is unchanged
+func (e *EncryptedState) AddIfVersion(ctx context.Context, key string, value interface{}, version string) (string, error) {
+	encrypted, err := e.encrypt(value)
+	if err != nil {
+		return "", err
+	}
+	return e.Persistence.AddIfVersion(ctx, key, encrypted, version)
+}
+
+// Get retrieves and decrypts a state
+func (e *EncryptedState) Get(ctx context.Context, key string, value interface{}) error {
+	_, err := e.GetVersioned(ctx, key, value)
+	return err
+}
+
+// GetVersioned retrieves and decrypts a state and returns its version
+func (e *EncryptedState) GetVersioned(ctx context.Context, key string, value interface{}) (string, error) {
+	var raw json.RawMessage
+	version, err := e.Persistence.GetVersioned(ctx, key, &raw)
+	if err != nil {
+		return "", err
+	}
+	return version, e.decrypt(key, raw, value)
+}
+
+// Prefetch reads all keys starting with prefix into the cache of the wrapped Persistence, values are decrypted on Get
+func (e *EncryptedState) Prefetch(ctx context.Context, prefix string) error {
+	return Prefetch(ctx, e.Persistence, prefix)
+}
+
+// Reencrypt encrypts all values starting with prefix with the current identity, i.e. to retire old identities.
+// Values changed concurrently are skipped, it returns the number of reencrypted values.
+func (e *EncryptedState) Reencrypt(ctx context.Context, prefix string) (int, error) {
+	keys, err := e.List(ctx, prefix)
+	if err != nil {
+		return 0, err
+	}
+	reencrypted := 0
+	for _, key := range keys {
+		var value json.RawMessage
+		version, err := e.GetVersioned(ctx, key, &value)
+		if err != nil {
+			return reencrypted, err
+		}
+		if _, err := e.AddIfVersion(ctx, key, value, version); err != nil {
+			if IsConflict(err) {
+				continue
+			}
+			return reencrypted, err
+		}
+		reencrypted++
+	}
+	return reencrypted, nil
+}
@@ -0,0 +1,114 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/app-sre/go-qontract-reconcile/pkg/vault"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestIdentity(t *testing.T) *age.X25519Identity {
+	identity, err := age.GenerateX25519Identity()
+	assert.NoError(t, err)
+	return identity
+}
+
+func TestEncryptedState(t *testing.T) {
+	ctx := context.Background()
+	fs, dir := newTestFilesystemState(t)
+	e, err := NewEncryptedState(fs, []*age.X25519Identity{newTestIdentity(t)})
+	assert.NoError(t, err)
+
+	assert.NoError(t, e.Add(ctx, "output/user", testValue{Name: "secret"}))
+	content, err := os.ReadFile(filepath.Join(dir, "state", "test", "output", "user"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(content), "secret")
+	assert.Contains(t, string(content), "BEGIN AGE ENCRYPTED FILE")
+
+	var value testValue
+	assert.NoError(t, e.Get(ctx, "output/user", &value))
+	assert.Equal(t, "secret", value.Name)
+
+	// Unencrypted legacy values are still read
+	assert.NoError(t, fs.Add(ctx, "legacy", testValue{Name: "plain"}))
+	assert.NoError(t, e.Get(ctx, "legacy", &value))
+	assert.Equal(t, "plain", value.Name)
+
+	// Values encrypted with unknown identities fail
+	other, err := NewEncryptedState(fs, []*age.X25519Identity{newTestIdentity(t)})
+	assert.NoError(t, err)
+	assert.ErrorContains(t, other.Get(ctx, "output/user", &value), "error decrypting state output/user")
+
+	_, err = NewEncryptedState(fs, nil)
+	assert.Error(t, err)
+}
+
+func TestEncryptedStateKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	fs, _ := newTestFilesystemState(t)
+	oldIdentity, newIdentity := newTestIdentity(t), newTestIdentity(t)
+
+	old, err := NewEncryptedState(fs, []*age.X25519Identity{oldIdentity})
+	assert.NoError(t, err)
+	assert.NoError(t, old.Add(ctx, "output/a", testValue{Name: "a"}))
+	assert.NoError(t, fs.Add(ctx, "output/legacy", testValue{Name: "legacy"}))
+
+	rotated, err := NewEncryptedState(fs, []*age.X25519Identity{newIdentity, oldIdentity})
+	assert.NoError(t, err)
+	var value testValue
+	assert.NoError(t, rotated.Get(ctx, "output/a", &value))
+	assert.Equal(t, "a", value.Name)
+
+	count, err := rotated.Reencrypt(ctx, "output/")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	// All values are readable without the old identity now
+	current, err := NewEncryptedState(fs, []*age.X25519Identity{newIdentity})
+	assert.NoError(t, err)
+	values, err := GetAll[testValue](ctx, current, "output/")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]testValue{"output/a": {Name: "a"}, "output/legacy": {Name: "legacy"}}, values)
+	assert.Error(t, old.Get(ctx, "output/legacy", &value))
+}
+
+func TestWithEncryption(t *testing.T) {
+	ctx := context.Background()
+	fs, _ := newTestFilesystemState(t)
+
+	p, err := WithEncryption(ctx, fs, nil)
+	assert.NoError(t, err)
+	assert.Same(t, fs, p)
+
+	identity := newTestIdentity(t)
+	vaultMock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/state-keys" {
+			identities := strings.ReplaceAll("# current\n"+identity.String()+"\n", "\n", `\n`)
+			fmt.Fprintf(w, `{"data": {"identities": "%s"}}`, identities)
+		}
+	}))
+	defer vaultMock.Close()
+	t.Setenv("VAULT_TOKEN", "token")
+	t.Setenv("VAULT_AUTHTYPE", "token")
+	t.Setenv("VAULT_SERVER", vaultMock.URL)
+	vc, err := vault.NewVaultClient()
+	assert.NoError(t, err)
+
+	t.Setenv("STATE_ENCRYPTION_VAULT_PATH", "state-keys")
+	p, err = WithEncryption(ctx, fs, vc)
+	assert.NoError(t, err)
+	assert.IsType(t, &EncryptedState{}, p)
+	assert.Equal(t, identity.Recipient().String(), p.(*EncryptedState).recipient.(*age.X25519Recipient).String())
+
+	t.Setenv("STATE_ENCRYPTION_VAULT_PATH", "missing")
+	_, err = WithEncryption(ctx, fs, vc)
+	assert.Error(t, err)
+}
@@ -0,0 +1,313 @@
+package state
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/app-sre/go-qontract-reconcile/pkg/util"
+	"github.com/spf13/viper"
+)
+
+var _ Persistence = &FilesystemState{}
+
+// fsLockFile is locked with flock around writes, it is kept in the directory of the infix
+const fsLockFile = ".lock"
+
+// FilesystemState implements Persistence using a local directory as a backend, keys use the same layout as S3State.
+// Writes hold an exclusive flock on a lock file in the directory, so conditional writes are atomic across all
+// instances and processes sharing a local directory.
+type FilesystemState struct {
+	basePath string
+	infix    string
+	config   fsStateConfig
+}
+
+type fsStateConfig struct {
+	Directory string
+}
+
+func newFsStateConfig() *fsStateConfig {
+	var fsc fsStateConfig
+	sub := util.EnsureViperSub(viper.GetViper(), "state_fs")
+	sub.SetDefault("directory", ".state")
+	sub.BindEnv("directory", "STATE_FS_DIRECTORY")
+	if err := sub.Unmarshal(&fsc); err != nil {
+		util.Log().Fatalw("Error while unmarshalling configuration %s", err.Error())
+	}
+	return &fsc
+}
+
+// NewFilesystemState creates a new FilesystemState Persistence object
+func NewFilesystemState(basePath, infix string) *FilesystemState {
+	return &FilesystemState{
+		basePath: basePath,
+		infix:    infix,
+		config:   *newFsStateConfig(),
+	}
+}
+
+func (s *FilesystemState) root() string {
+	return filepath.Join(s.config.Directory, s.basePath, s.infix)
+}
+
+// keyPath returns the file of key, it fails for keys pointing outside of the infix
+func (s *FilesystemState) keyPath(key string) (string, error) {
+	root := s.root()
+	path := filepath.Join(root, filepath.FromSlash(key))
+	if !strings.HasPrefix(path, root+string(filepath.Separator)) || path == filepath.Join(root, fsLockFile) {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	return path, nil
+}
+
+// lock takes the exclusive flock on the lock file of the directory, the returned function releases it
+func (s *FilesystemState) lock() (func(), error) {
+	root := s.root()
+	if err := os.MkdirAll(root, 0o700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(root, fsLockFile), os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// Exists checks if a given state exists in the directory
+func (s *FilesystemState) Exists(_ context.Context, key string) (bool, error) {
+	path, err := s.keyPath(key)
+	if err != nil {
+		return false, err
+	}
+	util.Log().Debugw("Check key existence in directory", "key", path)
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return !info.IsDir(), nil
+}
+
+// Add adds a given state to the directory
+func (s *FilesystemState) Add(_ context.Context, key string, value interface{}) error {
+	path, err := s.keyPath(key)
+	if err != nil {
+		return err
+	}
+	util.Log().Debugw("Writing key to directory", "key", path)
+	bytesOut, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return writeFile(path, bytesOut)
+}
+
+// AddIfVersion adds a given state to the directory if the hash of its content is unchanged
+func (s *FilesystemState) AddIfVersion(_ context.Context, key string, value interface{}, version string) (string, error) {
+	path, err := s.keyPath(key)
+	if err != nil {
+		return "", err
+	}
+	util.Log().Debugw("Writing key to directory if unchanged", "key", path, "version", version)
+	bytesOut, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	unlock, err := s.lock()
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	if version == "" {
+		err = createFile(key, path, bytesOut)
+	} else if err = checkVersion(key, path, version); err == nil {
+		err = writeFile(path, bytesOut)
+	}
+	if err != nil {
+		return "", err
+	}
+	return contentVersion(bytesOut), nil
+}
+
+// writeFile writes content to a temporary file first, so readers never see partially written values
+func writeFile(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// createFile writes content to a temporary file and links it to path, it fails with a ConflictError if path exists
+func createFile(key, path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Link(tmp.Name(), path); err != nil {
+		if os.IsExist(err) {
+			return &ConflictError{Key: key}
+		}
+		return err
+	}
+	return nil
+}
+
+// checkVersion fails with a ConflictError if the current version of path is not version
+func checkVersion(key, path, version string) error {
+	content, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		if version != "" {
+			return &ConflictError{Key: key, Version: version}
+		}
+		return nil
+	case err != nil:
+		return err
+	case contentVersion(content) != version:
+		return &ConflictError{Key: key, Version: version}
+	}
+	return nil
+}
+
+// contentVersion is the version of a state in the directory, the SHA256 of its content
+func contentVersion(content []byte) string {
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:])
+}
+
+// Get retrieves a state from the directory
+func (s *FilesystemState) Get(ctx context.Context, key string, value interface{}) error {
+	_, err := s.GetVersioned(ctx, key, value)
+	return err
+}
+
+// GetVersioned retrieves a state from the directory, the version is the hash of its content
+func (s *FilesystemState) GetVersioned(_ context.Context, key string, value interface{}) (string, error) {
+	path, err := s.keyPath(key)
+	if err != nil {
+		return "", err
+	}
+	util.Log().Debugw("Reading key from directory", "key", path)
+	bodyBytes, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return contentVersion(bodyBytes), json.Unmarshal(bodyBytes, value)
+}
+
+// Rm removes a state from the directory, removing a missing key is not an error like in S3
+func (s *FilesystemState) Rm(_ context.Context, key string) error {
+	path, err := s.keyPath(key)
+	if err != nil {
+		return err
+	}
+	util.Log().Debugw("Deleting key from directory", "key", path)
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// RmIfVersion removes a state from the directory if the hash of its content is unchanged
+func (s *FilesystemState) RmIfVersion(_ context.Context, key string, version string) error {
+	path, err := s.keyPath(key)
+	if err != nil {
+		return err
+	}
+	util.Log().Debugw("Deleting key from directory if unchanged", "key", path, "version", version)
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return &ConflictError{Key: key, Version: version}
+	}
+	if err := checkVersion(key, path, version); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// List returns all keys in the directory starting with prefix
+func (s *FilesystemState) List(_ context.Context, prefix string) ([]string, error) {
+	root := s.root()
+	util.Log().Debugw("Listing keys in directory", "directory", root, "prefix", prefix)
+	keys := []string{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root {
+				return nil
+			}
+			return err
+		}
+		// Skip directories, the lock file and temporary files of unfinished writes
+		if d.IsDir() || path == filepath.Join(root, fsLockFile) || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
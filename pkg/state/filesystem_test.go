@@ -0,0 +1,181 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/app-sre/go-qontract-reconcile/pkg/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+type testValue struct {
+	Name string `json:"name"`
+}
+
+func newTestFilesystemState(t *testing.T) (*FilesystemState, string) {
+	dir := t.TempDir()
+	t.Setenv("STATE_FS_DIRECTORY", dir)
+	return NewFilesystemState("state", "test"), dir
+}
+
+func TestFilesystemState(t *testing.T) {
+	ctx := context.Background()
+	s, dir := newTestFilesystemState(t)
+
+	exists, err := s.Exists(ctx, "output/account/user")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	assert.NoError(t, s.Add(ctx, "output/account/user", testValue{Name: "a"}))
+	content, err := os.ReadFile(filepath.Join(dir, "state", "test", "output", "account", "user"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"name": "a"}`, string(content))
+
+	exists, err = s.Exists(ctx, "output/account/user")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = s.Exists(ctx, "output/account")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	var value testValue
+	assert.NoError(t, s.Get(ctx, "output/account/user", &value))
+	assert.Equal(t, "a", value.Name)
+
+	assert.NoError(t, s.Rm(ctx, "output/account/user"))
+	assert.NoError(t, s.Rm(ctx, "output/account/user"))
+	assert.ErrorIs(t, s.Get(ctx, "output/account/user", &value), os.ErrNotExist)
+}
+
+func TestFilesystemStateInvalidKey(t *testing.T) {
+	s, _ := newTestFilesystemState(t)
+	assert.ErrorContains(t, s.Add(context.Background(), "../other/key", testValue{}), "invalid key")
+	_, err := s.Exists(context.Background(), "")
+	assert.ErrorContains(t, err, "invalid key")
+}
+
+func TestNewPersistence(t *testing.T) {
+	t.Setenv("STATE_BACKEND", BackendFilesystem)
+	p, err := NewPersistence("state", "test", func() (aws.Client, error) {
+		return nil, errors.New("no AWS client expected")
+	})
+	assert.NoError(t, err)
+	assert.IsType(t, &FilesystemState{}, p)
+
+	t.Setenv("STATE_BACKEND", BackendS3)
+	_, err = NewPersistence("state", "test", func() (aws.Client, error) {
+		return nil, errors.New("no credentials")
+	})
+	assert.EqualError(t, err, "no credentials")
+
+	t.Setenv("STATE_BACKEND", "gcs")
+	_, err = NewPersistence("state", "test", nil)
+	assert.EqualError(t, err, "unknown state backend gcs")
+}
+
+func TestFilesystemStateList(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestFilesystemState(t)
+
+	keys, err := s.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+
+	assert.NoError(t, s.Add(ctx, "output/b/bar", testValue{}))
+	assert.NoError(t, s.Add(ctx, "output/a/foo", testValue{}))
+	assert.NoError(t, s.Add(ctx, "failed", testValue{}))
+
+	keys, err = s.List(ctx, "output/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"output/a/foo", "output/b/bar"}, keys)
+
+	keys, err = s.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"failed", "output/a/foo", "output/b/bar"}, keys)
+}
+
+func TestFilesystemStateConditionalWrites(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestFilesystemState(t)
+
+	version, err := s.AddIfVersion(ctx, "key", testValue{Name: "a"}, "")
+	assert.NoError(t, err)
+	_, err = s.AddIfVersion(ctx, "key", testValue{Name: "b"}, "")
+	assert.True(t, IsConflict(err))
+
+	var value testValue
+	readVersion, err := s.GetVersioned(ctx, "key", &value)
+	assert.NoError(t, err)
+	assert.Equal(t, version, readVersion)
+
+	newVersion, err := s.AddIfVersion(ctx, "key", testValue{Name: "b"}, version)
+	assert.NoError(t, err)
+	assert.NotEqual(t, version, newVersion)
+	_, err = s.AddIfVersion(ctx, "key", testValue{Name: "c"}, version)
+	assert.True(t, IsConflict(err))
+
+	assert.True(t, IsConflict(s.RmIfVersion(ctx, "key", version)))
+	assert.NoError(t, s.RmIfVersion(ctx, "key", newVersion))
+	assert.True(t, IsConflict(s.RmIfVersion(ctx, "key", newVersion)))
+}
+
+func TestFilesystemStateConcurrentConditionalWrites(t *testing.T) {
+	ctx := context.Background()
+	first, _ := newTestFilesystemState(t)
+	// A second instance on the same directory, like another process would use
+	second := NewFilesystemState("state", "test")
+	instances := []*FilesystemState{first, second}
+
+	// Only one of several writers creates a key
+	var wg sync.WaitGroup
+	var created atomic.Int32
+	for n := 0; n < 10; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := instances[n%2].AddIfVersion(ctx, "key", testValue{Name: fmt.Sprint(n)}, ""); err == nil {
+				created.Add(1)
+			} else {
+				assert.True(t, IsConflict(err))
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), created.Load())
+
+	// Only one of several writers updates the version they read
+	var value testValue
+	version, err := first.GetVersioned(ctx, "key", &value)
+	assert.NoError(t, err)
+	var updated atomic.Int32
+	for n := 0; n < 10; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := instances[n%2].AddIfVersion(ctx, "key", testValue{Name: fmt.Sprintf("updated-%d", n)}, version); err == nil {
+				updated.Add(1)
+			} else {
+				assert.True(t, IsConflict(err))
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), updated.Load())
+
+	newVersion, err := second.GetVersioned(ctx, "key", &value)
+	assert.NoError(t, err)
+	assert.True(t, IsConflict(first.RmIfVersion(ctx, "key", version)))
+	assert.NoError(t, second.RmIfVersion(ctx, "key", newVersion))
+
+	// The lock file is not a key
+	keys, err := first.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+	assert.ErrorContains(t, first.Add(ctx, fsLockFile, testValue{}), "invalid key")
+}
@@ -5,12 +5,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"strings"
 
 	"github.com/app-sre/go-qontract-reconcile/pkg/aws"
 	"github.com/app-sre/go-qontract-reconcile/pkg/util"
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/spf13/viper"
 )
@@ -21,27 +25,106 @@ type Persistence interface {
 	Add(context.Context, string, interface{}) error
 	Rm(context.Context, string) error
 	Get(context.Context, string, interface{}) error
+	// List returns all keys starting with prefix, sorted
+	List(context.Context, string) ([]string, error)
+	// GetVersioned retrieves a state like Get and returns its current version
+	GetVersioned(context.Context, string, interface{}) (string, error)
+	// AddIfVersion adds a state only if its version is unchanged and returns the new version,
+	// an empty version only succeeds if the key does not exist. It fails with a ConflictError otherwise.
+	AddIfVersion(context.Context, string, interface{}, string) (string, error)
+	// RmIfVersion removes a state only if its version is unchanged, it fails with a ConflictError otherwise
+	RmIfVersion(context.Context, string, string) error
+}
+
+// ConflictError is returned by conditional writes and deletes if the key changed since it was read
+type ConflictError struct {
+	Key     string
+	Version string
+}
+
+func (e *ConflictError) Error() string {
+	if e.Version == "" {
+		return fmt.Sprintf("state %s was created concurrently", e.Key)
+	}
+	return fmt.Sprintf("state %s changed concurrently, expected version %s", e.Key, e.Version)
+}
+
+// Conflict marks the error as conflict for packages, that can not import state
+func (e *ConflictError) Conflict() bool {
+	return true
+}
+
+// IsConflict checks if err is a ConflictError
+func IsConflict(err error) bool {
+	var conflict *ConflictError
+	return errors.As(err, &conflict)
+}
+
+// GetAll retrieves the values of all keys starting with prefix
+func GetAll[T any](ctx context.Context, p Persistence, prefix string) (map[string]T, error) {
+	keys, err := p.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]T, len(keys))
+	for _, key := range keys {
+		var value T
+		if err := p.Get(ctx, key, &value); err != nil {
+			return nil, fmt.Errorf("error getting key %s: %w", key, err)
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+const (
+	// BackendS3 stores state in the app-interface state bucket
+	BackendS3 = "s3"
+	// BackendFilesystem stores state in a local directory, i.e. for local development
+	BackendFilesystem = "filesystem"
+)
+
+// NewPersistence creates the Persistence selected by state_backend, newClient is only called for the s3 backend
+func NewPersistence(basePath, infix string, newClient func() (aws.Client, error)) (Persistence, error) {
+	v := viper.GetViper()
+	v.SetDefault("state_backend", BackendS3)
+	v.BindEnv("state_backend", "STATE_BACKEND")
+	switch backend := v.GetString("state_backend"); backend {
+	case BackendS3:
+		client, err := newClient()
+		if err != nil {
+			return nil, err
+		}
+		return NewS3State(basePath, infix, client), nil
+	case BackendFilesystem:
+		return NewFilesystemState(basePath, infix), nil
+	default:
+		return nil, fmt.Errorf("unknown state backend %s", backend)
+	}
 }
 
 var _ Persistence = &S3State{}
 
 // S3State implements Persistence using AWS S3 as a backend
 type S3State struct {
-	state    map[string]interface{}
 	basePath string
 	infix    string
 	config   s3StateConfig
 	client   aws.Client
+	cache    *s3Cache
 }
 
 type s3StateConfig struct {
-	Bucket string
+	Bucket              string
+	PrefetchConcurrency int
 }
 
 func newS3StateConfig() *s3StateConfig {
 	var s3c s3StateConfig
 	sub := util.EnsureViperSub(viper.GetViper(), "state_s3")
+	sub.SetDefault("prefetchconcurrency", 10)
 	sub.BindEnv("bucket", "APP_INTERFACE_STATE_BUCKET")
+	sub.BindEnv("prefetchconcurrency", "STATE_S3_PREFETCH_CONCURRENCY")
 	if err := sub.Unmarshal(&s3c); err != nil {
 		util.Log().Fatalw("Error while unmarshalling configuration %s", err.Error())
 	}
@@ -52,21 +135,28 @@ func newS3StateConfig() *s3StateConfig {
 func NewS3State(basePath, infix string, client aws.Client) *S3State {
 	config := *newS3StateConfig()
 	state := &S3State{
-		state:    make(map[string]interface{}),
 		basePath: basePath,
 		infix:    infix,
 		client:   client,
 		config:   config,
+		cache:    newS3Cache(infix),
 	}
 	return state
 }
 
 func (s *S3State) keyPath(key string) *string {
-	return util.StrPointer(fmt.Sprintf("%s/%s/%s", s.basePath, s.infix, key))
+	return util.StrPointer(s.keyPrefix() + key)
 }
 
-// Exists checks if a given state exists in S3
+func (s *S3State) keyPrefix() string {
+	return fmt.Sprintf("%s/%s/", s.basePath, s.infix)
+}
+
+// Exists checks if a given state exists in S3, or in the cache after Prefetch
 func (s *S3State) Exists(ctx context.Context, key string) (bool, error) {
+	if exists, ok := s.cache.exists(key); ok {
+		return exists, nil
+	}
 	util.Log().Debugw("Check key existence in bucket", "key", s.keyPath(key), "bucket", s.config.Bucket)
 	_, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
 		Bucket: &s.config.Bucket,
@@ -89,17 +179,40 @@ func (s *S3State) Add(ctx context.Context, key string, value interface{}) error
 		return err
 	}
 
-	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+	resp, err := s.client.PutObject(ctx, &s3.PutObjectInput{
 		Bucket:      &s.config.Bucket,
 		Key:         s.keyPath(key),
 		ContentType: util.StrPointer("application/json"),
 		Body:        bytes.NewReader(bytesOut),
 	})
-	return err
+	if err != nil {
+		s.cache.invalidate(key)
+		return err
+	}
+	s.cache.put(key, bytesOut, putETag(resp))
+	return nil
 }
 
 // Get retrieves a state from S3
 func (s *S3State) Get(ctx context.Context, key string, value interface{}) error {
+	_, err := s.GetVersioned(ctx, key, value)
+	return err
+}
+
+// GetVersioned retrieves a state from S3, or from the cache after Prefetch. The version is the ETag of the object.
+func (s *S3State) GetVersioned(ctx context.Context, key string, value interface{}) (string, error) {
+	if obj, ok := s.cache.get(key); ok {
+		return obj.etag, json.Unmarshal(obj.body, value)
+	}
+	obj, err := s.getObject(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	s.cache.put(key, obj.body, obj.etag)
+	return obj.etag, json.Unmarshal(obj.body, value)
+}
+
+func (s *S3State) getObject(ctx context.Context, key string) (*cachedObject, error) {
 	util.Log().Debugw("Getting key from bucket", "key", s.keyPath(key), "bucket", s.config.Bucket)
 	resp, err := s.client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket:              &s.config.Bucket,
@@ -107,14 +220,88 @@ func (s *S3State) Get(ctx context.Context, key string, value interface{}) error
 		ResponseContentType: util.StrPointer("application/json"),
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer resp.Body.Close()
 
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
+		return nil, err
+	}
+	return &cachedObject{body: bodyBytes, etag: awssdk.ToString(resp.ETag)}, nil
+}
+
+// putETag returns the ETag of a written object
+func putETag(resp *s3.PutObjectOutput) string {
+	if resp == nil {
+		return ""
+	}
+	return awssdk.ToString(resp.ETag)
+}
+
+// AddIfVersion adds a given state to S3 using a conditional PutObject
+func (s *S3State) AddIfVersion(ctx context.Context, key string, value interface{}, version string) (string, error) {
+	util.Log().Debugw("Putting key to bucket if unchanged", "key", s.keyPath(key), "bucket", s.config.Bucket, "version", version)
+	bytesOut, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:      &s.config.Bucket,
+		Key:         s.keyPath(key),
+		ContentType: util.StrPointer("application/json"),
+		Body:        bytes.NewReader(bytesOut),
+	}
+	if version == "" {
+		input.IfNoneMatch = util.StrPointer("*")
+	} else {
+		input.IfMatch = &version
+	}
+	resp, err := s.client.PutObject(ctx, input)
+	if err != nil {
+		s.cache.invalidate(key)
+		if isS3Conflict(err) {
+			return "", &ConflictError{Key: key, Version: version}
+		}
+		return "", err
+	}
+	s.cache.put(key, bytesOut, putETag(resp))
+	return putETag(resp), nil
+}
+
+// RmIfVersion removes a state from S3 using a conditional DeleteObject
+func (s *S3State) RmIfVersion(ctx context.Context, key string, version string) error {
+	util.Log().Debugw("Deleting key from bucket if unchanged", "key", s.keyPath(key), "bucket", s.config.Bucket, "version", version)
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket:  &s.config.Bucket,
+		Key:     s.keyPath(key),
+		IfMatch: &version,
+	})
+	if err != nil {
+		s.cache.invalidate(key)
+		// A conditional delete of a missing key fails with 404
+		if isS3Conflict(err) || responseStatusCode(err) == http.StatusNotFound {
+			return &ConflictError{Key: key, Version: version}
+		}
 		return err
 	}
-	return json.Unmarshal(bodyBytes, value)
+	s.cache.remove(key)
+	return nil
+}
+
+// isS3Conflict checks if err is caused by a failed condition, or a concurrent conditional write
+func isS3Conflict(err error) bool {
+	code := responseStatusCode(err)
+	return code == http.StatusPreconditionFailed || code == http.StatusConflict
+}
+
+func responseStatusCode(err error) int {
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.HTTPStatusCode()
+	}
+	return 0
 }
 
 // Rm removes a state from S3
@@ -125,7 +312,23 @@ func (s *S3State) Rm(ctx context.Context, key string) error {
 		Key:    s.keyPath(key),
 	})
 	if err != nil {
+		s.cache.invalidate(key)
 		return err
 	}
+	s.cache.remove(key)
 	return nil
 }
+
+// List returns all keys in S3 starting with prefix
+func (s *S3State) List(ctx context.Context, prefix string) ([]string, error) {
+	util.Log().Debugw("Listing keys in bucket", "prefix", s.keyPath(prefix), "bucket", s.config.Bucket)
+	objects, err := aws.ListObjects(ctx, s.client, s.config.Bucket, *s.keyPath(prefix))
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		keys = append(keys, strings.TrimPrefix(*obj.Key, s.keyPrefix()))
+	}
+	return keys, nil
+}
@@ -0,0 +1,135 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/app-sre/go-qontract-reconcile/pkg/aws/mock"
+	"github.com/app-sre/go-qontract-reconcile/pkg/util"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestS3StateList(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mock.NewMockClient(ctrl)
+	t.Setenv("APP_INTERFACE_STATE_BUCKET", "bucket")
+	truncated := true
+
+	gomock.InOrder(
+		mockClient.EXPECT().ListObjectsV2(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, input *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+				assert.Equal(t, "bucket", *input.Bucket)
+				assert.Equal(t, "state/test/output/", *input.Prefix)
+				assert.Nil(t, input.ContinuationToken)
+				return &s3.ListObjectsV2Output{
+					Contents:              []types.Object{{Key: util.StrPointer("state/test/output/a/foo")}},
+					IsTruncated:           &truncated,
+					NextContinuationToken: util.StrPointer("next"),
+				}, nil
+			}),
+		mockClient.EXPECT().ListObjectsV2(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, input *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+				assert.Equal(t, "next", *input.ContinuationToken)
+				return &s3.ListObjectsV2Output{
+					Contents: []types.Object{{Key: util.StrPointer("state/test/output/b/bar")}},
+				}, nil
+			}),
+	)
+
+	keys, err := NewS3State("state", "test", mockClient).List(context.Background(), "output/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"output/a/foo", "output/b/bar"}, keys)
+}
+
+func TestGetAll(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestFilesystemState(t)
+	assert.NoError(t, s.Add(ctx, "output/a/foo", testValue{Name: "foo"}))
+	assert.NoError(t, s.Add(ctx, "output/b/bar", testValue{Name: "bar"}))
+	assert.NoError(t, s.Add(ctx, "failed", testValue{Name: "failed"}))
+
+	values, err := GetAll[testValue](ctx, s, "output/")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]testValue{
+		"output/a/foo": {Name: "foo"},
+		"output/b/bar": {Name: "bar"},
+	}, values)
+}
+
+func newS3ResponseError(statusCode int) error {
+	return &awshttp.ResponseError{
+		ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: statusCode}},
+			Err:      errors.New("api error"),
+		},
+	}
+}
+
+func TestS3StateConditionalWrites(t *testing.T) {
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mock.NewMockClient(ctrl)
+	s := NewS3State("state", "test", mockClient)
+
+	gomock.InOrder(
+		mockClient.EXPECT().PutObject(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, input *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+				assert.Equal(t, "*", *input.IfNoneMatch)
+				assert.Nil(t, input.IfMatch)
+				return &s3.PutObjectOutput{ETag: util.StrPointer(`"v1"`)}, nil
+			}),
+		mockClient.EXPECT().PutObject(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, input *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+				assert.Equal(t, `"v1"`, *input.IfMatch)
+				assert.Nil(t, input.IfNoneMatch)
+				return nil, newS3ResponseError(http.StatusPreconditionFailed)
+			}),
+		mockClient.EXPECT().DeleteObject(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, input *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+				assert.Equal(t, `"v1"`, *input.IfMatch)
+				return nil, newS3ResponseError(http.StatusNotFound)
+			}),
+		mockClient.EXPECT().DeleteObject(gomock.Any(), gomock.Any()).Return(nil, newS3ResponseError(http.StatusForbidden)),
+	)
+
+	version, err := s.AddIfVersion(ctx, "key", testValue{Name: "a"}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, `"v1"`, version)
+
+	_, err = s.AddIfVersion(ctx, "key", testValue{Name: "b"}, version)
+	var conflict *ConflictError
+	assert.ErrorAs(t, err, &conflict)
+	assert.Equal(t, &ConflictError{Key: "key", Version: `"v1"`}, conflict)
+
+	assert.True(t, IsConflict(s.RmIfVersion(ctx, "key", version)))
+	err = s.RmIfVersion(ctx, "key", version)
+	assert.Error(t, err)
+	assert.False(t, IsConflict(err))
+}
+
+func TestS3StateGetVersioned(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := mock.NewMockClient(ctrl)
+	mockClient.EXPECT().GetObject(gomock.Any(), gomock.Any()).Return(&s3.GetObjectOutput{
+		Body: io.NopCloser(strings.NewReader(`{"name": "a"}`)),
+		ETag: util.StrPointer(`"v1"`),
+	}, nil)
+
+	var value testValue
+	version, err := NewS3State("state", "test", mockClient).GetVersioned(context.Background(), "key", &value)
+	assert.NoError(t, err)
+	assert.Equal(t, `"v1"`, version)
+	assert.Equal(t, "a", value.Name)
+}
@@ -0,0 +1,162 @@
+// Package tracing configures optional OpenTelemetry tracing for integrations
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/app-sre/go-qontract-reconcile/pkg/util"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// ExporterNone disables tracing
+	ExporterNone = ""
+	// ExporterOTLP sends spans to an OTLP/HTTP collector
+	ExporterOTLP = "otlp"
+	// ExporterFile writes spans as JSON to a file
+	ExporterFile = "file"
+
+	tracerName = "github.com/app-sre/go-qontract-reconcile"
+)
+
+type tracingConfig struct {
+	Exporter    string
+	Endpoint    string
+	Insecure    bool
+	File        string
+	ServiceName string
+}
+
+func newTracingConfig() *tracingConfig {
+	var tc tracingConfig
+	sub := util.EnsureViperSub(viper.GetViper(), "tracing")
+	sub.SetDefault("exporter", ExporterNone)
+	sub.SetDefault("endpoint", "")
+	sub.SetDefault("insecure", false)
+	sub.SetDefault("file", "traces.json")
+	sub.SetDefault("servicename", "go-qontract-reconcile")
+	sub.BindEnv("exporter", "TRACING_EXPORTER")
+	sub.BindEnv("endpoint", "TRACING_ENDPOINT")
+	sub.BindEnv("insecure", "TRACING_INSECURE")
+	sub.BindEnv("file", "TRACING_FILE")
+	sub.BindEnv("servicename", "TRACING_SERVICE_NAME")
+	if err := sub.Unmarshal(&tc); err != nil {
+		util.Log().Fatalw("Error while unmarshalling configuration %s", err.Error())
+	}
+	return &tc
+}
+
+var (
+	mu       sync.Mutex
+	shutdown func(context.Context) error
+)
+
+// Setup installs a global TracerProvider according to the tracing configuration, without an exporter spans are dropped
+func Setup(ctx context.Context) error {
+	config := newTracingConfig()
+
+	var exporter sdktrace.SpanExporter
+	var closer func() error
+	switch config.Exporter {
+	case ExporterNone:
+		return nil
+	case ExporterOTLP:
+		opts := []otlptracehttp.Option{}
+		if config.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(config.Endpoint))
+		}
+		if config.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		e, err := otlptracehttp.New(ctx, opts...)
+		if err != nil {
+			return fmt.Errorf("error creating OTLP exporter: %w", err)
+		}
+		exporter = e
+	case ExporterFile:
+		f, err := os.Create(config.File)
+		if err != nil {
+			return fmt.Errorf("error creating trace file: %w", err)
+		}
+		e, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("error creating file exporter: %w", err)
+		}
+		exporter = e
+		closer = f.Close
+	default:
+		return fmt.Errorf("unsupported tracing exporter %q", config.Exporter)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(config.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	mu.Lock()
+	defer mu.Unlock()
+	shutdown = func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closer != nil {
+			if cerr := closer(); err == nil {
+				err = cerr
+			}
+		}
+		return err
+	}
+	util.Log().Debugw("Tracing enabled", "exporter", config.Exporter)
+	return nil
+}
+
+// Shutdown flushes pending spans and stops the exporter configured by Setup, it is safe to call without Setup
+func Shutdown(ctx context.Context) {
+	mu.Lock()
+	defer mu.Unlock()
+	if shutdown == nil {
+		return
+	}
+	if err := shutdown(ctx); err != nil {
+		util.Log().Warnw("Error while shutting down tracing", "error", err.Error())
+	}
+	shutdown = nil
+}
+
+// Start creates a span named name as child of any span in ctx
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err on span and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Transport wraps base to create a span for every HTTP request, a nil base uses http.DefaultTransport
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return otelhttp.NewTransport(base)
+}
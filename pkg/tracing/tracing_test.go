@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSetupDisabled(t *testing.T) {
+	t.Setenv("TRACING_EXPORTER", "")
+	assert.NoError(t, Setup(context.Background()))
+	Shutdown(context.Background())
+}
+
+func TestSetupUnsupportedExporter(t *testing.T) {
+	t.Setenv("TRACING_EXPORTER", "jaeger")
+	assert.ErrorContains(t, Setup(context.Background()), "unsupported tracing exporter")
+}
+
+func TestSetupFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.json")
+	t.Setenv("TRACING_EXPORTER", ExporterFile)
+	t.Setenv("TRACING_FILE", path)
+	provider := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(provider)
+
+	assert.NoError(t, Setup(context.Background()))
+	ctx, parent := Start(context.Background(), "parent")
+	_, child := Start(ctx, "child")
+	End(child, errors.New("failed"))
+	End(parent, nil)
+	Shutdown(context.Background())
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `"Name":"parent"`)
+	assert.Contains(t, string(content), `"Name":"child"`)
+	assert.Contains(t, string(content), `"Description":"failed"`)
+}
+
+func TestEnd(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(provider)
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+
+	ctx, parent := Start(context.Background(), "parent")
+	_, child := Start(ctx, "child")
+	End(child, errors.New("failed"))
+	End(parent, nil)
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 2)
+	assert.Equal(t, "child", spans[0].Name)
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	assert.Equal(t, spans[1].SpanContext.SpanID(), spans[0].Parent.SpanID())
+	assert.Equal(t, codes.Unset, spans[1].Status.Code)
+}
@@ -52,6 +52,22 @@ func Retry(attempts int, sleep time.Duration, callbackFunc func() error) error {
 	return nil
 }
 
+// Backoff returns the delay before the given attempt, starting at sleep and growing by the same
+// factor and jitter Retry uses. The delay never exceeds max, a max of 0 disables the cap.
+func Backoff(attempt int, sleep, max time.Duration) time.Duration {
+	if sleep <= 0 {
+		return 0
+	}
+	for n := 1; n < attempt && (max <= 0 || sleep < max); n++ {
+		sleep *= sleepStepFactor
+	}
+	sleep += jitter(sleep) / jitterHelveFactor
+	if max > 0 && sleep > max {
+		return max
+	}
+	return sleep
+}
+
 // RetryStop wraps the given error in a private retryError type and returns it to
 // signal that a retry loop should stop attempting the operation that produced the
 // given error.
@@ -93,3 +93,17 @@ func TestRetry(t *testing.T) {
 		})
 	}
 }
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, time.Duration(0), Backoff(1, 0, time.Minute))
+
+	first := Backoff(1, time.Second, time.Minute)
+	assert.GreaterOrEqual(t, first, time.Second)
+	assert.Less(t, first, 1500*time.Millisecond)
+
+	third := Backoff(3, time.Second, time.Minute)
+	assert.GreaterOrEqual(t, third, 4*time.Second)
+	assert.Less(t, third, 6*time.Second)
+
+	assert.Equal(t, time.Minute, Backoff(10, time.Second, time.Minute))
+}
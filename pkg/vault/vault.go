@@ -7,12 +7,15 @@ import (
 	"strings"
 	"time"
 
+	"github.com/app-sre/go-qontract-reconcile/pkg/tracing"
 	"github.com/app-sre/go-qontract-reconcile/pkg/util"
 	"github.com/hashicorp/vault/api"
 	"github.com/hashicorp/vault/api/auth/approle"
 	"github.com/hashicorp/vault/api/auth/kubernetes"
 
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -34,6 +37,8 @@ const (
 type Client struct {
 	client *api.Client
 	config *vaultConfig
+	// ctx is used for requests and as parent of their spans, see WithContext
+	ctx context.Context
 }
 
 // Disable lint, cause names should match Qontract Reconcile
@@ -112,9 +117,27 @@ func NewVaultClient() (*Client, error) {
 	return vaultClient, nil
 }
 
+// WithContext returns a copy of the Client using ctx for all requests
+func (v *Client) WithContext(ctx context.Context) *Client {
+	c := *v
+	c.ctx = ctx
+	return &c
+}
+
+// startSpan starts a span for the request op on secretPath
+func (v *Client) startSpan(op, secretPath string) (context.Context, trace.Span) {
+	ctx := v.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return tracing.Start(ctx, "vault "+op, attribute.String("vault.path", secretPath))
+}
+
 // ReadSecret do a logical read on a given Secret Path
-func (v *Client) ReadSecret(secretPath string) (*api.Secret, error) {
-	return v.client.Logical().Read(secretPath)
+func (v *Client) ReadSecret(secretPath string) (secret *api.Secret, err error) {
+	ctx, span := v.startSpan("read", secretPath)
+	defer func() { tracing.End(span, err) }()
+	return v.client.Logical().ReadWithContext(ctx, secretPath)
 }
 
 // SecretList is a list of secrets
@@ -123,8 +146,10 @@ type SecretList struct {
 }
 
 // ListSecrets list secrets on a given Secret Path
-func (v *Client) ListSecrets(secretPath string) (*SecretList, error) {
-	secret, err := v.client.Logical().List(secretPath)
+func (v *Client) ListSecrets(secretPath string) (list *SecretList, err error) {
+	ctx, span := v.startSpan("list", secretPath)
+	defer func() { tracing.End(span, err) }()
+	secret, err := v.client.Logical().ListWithContext(ctx, secretPath)
 	if err != nil {
 		return nil, err
 	}
@@ -147,13 +172,17 @@ func (v *Client) ListSecrets(secretPath string) (*SecretList, error) {
 }
 
 // WriteSecret do a logical write on a given Secret Path
-func (v *Client) WriteSecret(secretPath string, secret map[string]interface{}) (*api.Secret, error) {
-	return v.client.Logical().Write(secretPath, secret)
+func (v *Client) WriteSecret(secretPath string, secret map[string]interface{}) (written *api.Secret, err error) {
+	ctx, span := v.startSpan("write", secretPath)
+	defer func() { tracing.End(span, err) }()
+	return v.client.Logical().WriteWithContext(ctx, secretPath, secret)
 }
 
 // DeleteSecret do a logical delete on a given Secret Path
-func (v *Client) DeleteSecret(secretPath string) (*api.Secret, error) {
-	return v.client.Logical().Delete(secretPath)
+func (v *Client) DeleteSecret(secretPath string) (deleted *api.Secret, err error) {
+	ctx, span := v.startSpan("delete", secretPath)
+	defer func() { tracing.End(span, err) }()
+	return v.client.Logical().DeleteWithContext(ctx, secretPath)
 }
 
 func approleAuthLogin(ctx context.Context, client *Client) error {